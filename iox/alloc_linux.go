@@ -0,0 +1,42 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"os"
+	"syscall"
+)
+
+// allocate reserves size bytes of disk space for f.
+func allocate(f *os.File, size int64) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var allocErr error
+	err = rc.Control(func(fd uintptr) {
+		allocErr = syscall.Fallocate(int(fd), 0, 0, size)
+	})
+	if err != nil {
+		return err
+	}
+	if allocErr == syscall.EOPNOTSUPP || allocErr == syscall.ENOSYS {
+		return f.Truncate(size) // filesystem cannot fallocate
+	}
+	if allocErr != nil {
+		return &os.PathError{Op: "fallocate", Path: f.Name(), Err: allocErr}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"context"
+	"os"
+)
+
+// An AppendFile is a File opened for appending that has no Seek or
+// read methods.
+//
+// Every Write goes to the end of the file, even when other processes
+// or other AppendFiles are appending to it at the same time, and
+// there is no way to move the offset and break that.
+type AppendFile struct {
+	file *File
+}
+
+// OpenAppend opens the named file for appending, creating it with
+// perm if it does not exist, and returns it as an AppendFile.
+func (f *Filer) OpenAppend(name string, perm os.FileMode) (*AppendFile, error) {
+	file, err := f.openFile(context.Background(), name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, perm, openOptions{origin: OriginOpenGeneral})
+	if err != nil {
+		return nil, err
+	}
+	file.setCreator(callers(f))
+	return &AppendFile{file: file}, nil
+}
+
+// Name returns the name of the file as passed to OpenAppend.
+func (a *AppendFile) Name() string { return a.file.Name() }
+
+// Write appends b to the file in a single system call.
+func (a *AppendFile) Write(b []byte) (int, error) { return a.file.Write(b) }
+
+func (a *AppendFile) WriteString(s string) (int, error) { return a.file.WriteString(s) }
+func (a *AppendFile) Sync() error                       { return a.file.Sync() }
+func (a *AppendFile) Stat() (os.FileInfo, error)        { return a.file.Stat() }
+
+// Close closes the file, releasing its file descriptor slot.
+func (a *AppendFile) Close() error { return a.file.Close() }
@@ -0,0 +1,84 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestOpenAppend(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "log")
+	if err := ioutil.WriteFile(name, []byte("start\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	filer := NewFiler(1)
+	a, err := filer.OpenAppend(name, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v interface{} = a
+	if _, ok := v.(io.Seeker); ok {
+		t.Error("AppendFile is an io.Seeker")
+	}
+	if _, ok := v.(io.Reader); ok {
+		t.Error("AppendFile is an io.Reader")
+	}
+
+	const writers, lines, lineLen = 2, 500, 512
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		line := append(bytes.Repeat([]byte{byte('a' + i)}, lineLen-1), '\n')
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				if _, err := a.Write(line); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := a.Sync(); err != nil {
+		t.Error(err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, []byte("start\n")) {
+		t.Fatalf("existing contents overwritten: %q", b[:16])
+	}
+	got := bytes.Split(bytes.TrimSuffix(b[len("start\n"):], []byte("\n")), []byte("\n"))
+	if len(got) != writers*lines {
+		t.Fatalf("%d lines, want %d", len(got), writers*lines)
+	}
+	for i, line := range got {
+		if len(line) != lineLen-1 || bytes.Count(line, line[:1]) != lineLen-1 {
+			t.Fatalf("line %d interleaved: %q", i, line)
+		}
+	}
+}
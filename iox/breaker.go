@@ -0,0 +1,105 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen is returned by opens while the Filer's OpenBreaker
+// has tripped.
+var ErrBreakerOpen = errors.New("iox: open failing fast after repeated errors")
+
+// BreakerConfig configures a circuit breaker on opens, so that a
+// failing filesystem, such as a disk that has gone read-only, is not
+// hammered with opens bound to fail.
+//
+// After Threshold consecutive failed opens, the first of them no more
+// than Window ago, the breaker trips and opens fail with
+// ErrBreakerOpen for Cooldown. The next open after that is tried; if
+// it succeeds the breaker resets, otherwise it trips again. Other opens
+// fail fast while that probe is in progress.
+//
+// An open failing because the file already exists, as when creating
+// temporary files, does not count as a failure.
+type BreakerConfig struct {
+	Threshold int // zero disables the breaker
+	Window    time.Duration
+	Cooldown  time.Duration
+}
+
+// breaker is the state of a Filer's OpenBreaker.
+type breaker struct {
+	mu        sync.Mutex
+	failures  int       // consecutive failed opens
+	firstFail time.Time // when the first of failures happened
+	openUntil time.Time // tripped until then
+	probing   bool      // an open is testing recovery
+}
+
+// allow reports whether an open may be tried.
+// If probe is set, the open is testing recovery and its result
+// must be passed to done.
+func (b *breaker) allow(c *BreakerConfig) (probe bool, err error) {
+	if c.Threshold <= 0 {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return false, nil
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false, ErrBreakerOpen
+	}
+	b.probing = true
+	return true, nil
+}
+
+// done records the result of an open.
+func (b *breaker) done(c *BreakerConfig, probe bool, err error) {
+	if c.Threshold <= 0 {
+		return
+	}
+	failed := err != nil && !os.IsExist(err)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if !failed {
+		if probe || b.failures > 0 {
+			b.failures = 0
+			b.openUntil = time.Time{}
+		}
+		return
+	}
+	now := time.Now()
+	if probe {
+		b.openUntil = now.Add(c.Cooldown)
+		return
+	}
+	if b.failures == 0 || now.Sub(b.firstFail) > c.Window {
+		b.failures = 0
+		b.firstFail = now
+	}
+	b.failures++
+	if b.failures >= c.Threshold {
+		b.openUntil = now.Add(c.Cooldown)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestOpenBreaker(t *testing.T) {
+	var attempts int
+	fail := true
+	osOpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		attempts++
+		if fail {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EIO}
+		}
+		return os.OpenFile(name, flag, perm)
+	}
+	defer func() { osOpenFile = os.OpenFile }()
+
+	const cooldown = 50 * time.Millisecond
+	filer := NewFiler(1)
+	filer.OpenBreaker = BreakerConfig{Threshold: 3, Window: time.Minute, Cooldown: cooldown}
+	name := os.Args[0]
+
+	for i := 0; i < 3; i++ {
+		if _, err := filer.Open(name); !errors.Is(err, syscall.EIO) {
+			t.Fatalf("open %d: %v, want EIO", i, err)
+		}
+	}
+	if _, err := filer.Open(name); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("open after threshold: %v, want ErrBreakerOpen", err)
+	}
+	if attempts != 3 {
+		t.Errorf("%d open attempts, want 3", attempts)
+	}
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("%d slots held, want 0", got)
+	}
+
+	// A failed probe trips the breaker again.
+	time.Sleep(cooldown)
+	if _, err := filer.Open(name); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("probe: %v, want EIO", err)
+	}
+	if _, err := filer.Open(name); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("open after failed probe: %v, want ErrBreakerOpen", err)
+	}
+
+	// A successful probe resets it.
+	fail = false
+	time.Sleep(cooldown)
+	for i := 0; i < 2; i++ {
+		f, err := filer.Open(name)
+		if err != nil {
+			t.Fatalf("open %d after recovery: %v", i, err)
+		}
+		f.Close()
+	}
+
+	// Only consecutive failures within the window count.
+	filer.OpenBreaker.Window = time.Millisecond
+	fail = true
+	for i := 0; i < 5; i++ {
+		time.Sleep(2 * time.Millisecond)
+		if _, err := filer.Open(name); !errors.Is(err, syscall.EIO) {
+			t.Fatalf("spaced open %d: %v, want EIO", i, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import "sync"
+
+// A Budget is a number of file descriptors shared by several Filers,
+// so that together they never have more files open than it allows.
+//
+// Each Filer attached to a Budget still keeps its own limit and wait
+// queue. Waiters are served in order within a Filer, but when the
+// Budget is exhausted there is no ordering between Filers.
+type Budget struct {
+	mu      sync.Mutex
+	total   int
+	used    int
+	blocked map[*Filer]struct{} // Filers with waiters refused for want of budget
+}
+
+// NewBudget creates a Budget of total file descriptors.
+// If total is 0, the Budget is 90% of the process's allowed files.
+func NewBudget(total int) *Budget {
+	if total == 0 {
+		total = defaultFDLimit()
+	}
+	return &Budget{
+		total:   total,
+		blocked: make(map[*Filer]struct{}),
+	}
+}
+
+// NewFilerWithBudget creates a Filer that takes its file descriptors
+// from b. Its own limit starts out as the whole Budget, and can be
+// lowered with SetFDLimit.
+func NewFilerWithBudget(b *Budget, opts ...Option) *Filer {
+	f := NewFilerWithOptions(b.total, opts...)
+	f.budget = b
+	return f
+}
+
+// takeLocked reports whether n more slots are free, and if so
+// takes them from the Budget. The caller must then use them.
+// It must be called with f.mu held.
+func (f *Filer) takeLocked(n int) bool {
+	if f.usedLocked()+n > f.fdlimit {
+		return false
+	}
+	b := f.budget
+	if b == nil {
+		return true
+	}
+	f.syncBudgetLocked()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used+n > b.total {
+		b.blocked[f] = struct{}{}
+		return false
+	}
+	b.used += n
+	f.budgeted += n
+	return true
+}
+
+// syncBudgetLocked returns the slots f has freed to the Budget,
+// and wakes the other Filers waiting for them.
+// It must be called with f.mu held.
+func (f *Filer) syncBudgetLocked() {
+	b := f.budget
+	if b == nil {
+		return
+	}
+	freed := f.budgeted - f.usedLocked()
+	if freed <= 0 {
+		return
+	}
+	f.budgeted -= freed
+
+	b.mu.Lock()
+	b.used -= freed
+	var wake []*Filer
+	for g := range b.blocked {
+		if g != f {
+			wake = append(wake, g)
+		}
+		delete(b.blocked, g)
+	}
+	b.mu.Unlock()
+
+	// Another Filer's lock cannot be taken while holding f.mu,
+	// as it may be doing the same in reverse.
+	for _, g := range wake {
+		go func(g *Filer) {
+			g.mu.Lock()
+			g.grantLocked()
+			g.unlock()
+		}(g)
+	}
+}
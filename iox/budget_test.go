@@ -0,0 +1,100 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBudget(t *testing.T) {
+	const total = 10
+	b := NewBudget(total)
+	filers := []*Filer{NewFilerWithBudget(b), NewFilerWithBudget(b)}
+
+	var open, maxOpen int32
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(filer *Filer) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				f, err := filer.TempFile("", "iox-budget-", "")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				n := atomic.AddInt32(&open, 1)
+				for {
+					max := atomic.LoadInt32(&maxOpen)
+					if n <= max || atomic.CompareAndSwapInt32(&maxOpen, max, n) {
+						break
+					}
+				}
+				time.Sleep(100 * time.Microsecond)
+				atomic.AddInt32(&open, -1)
+				if err := f.Close(); err != nil {
+					t.Error(err)
+				}
+			}
+		}(filers[i%len(filers)])
+	}
+	wg.Wait()
+
+	if maxOpen > total {
+		t.Errorf("%d files open at once, budget is %d", maxOpen, total)
+	}
+	for i, filer := range filers {
+		if peak := filer.Stats().Peak; peak > total {
+			t.Errorf("filer %d: peak %d above budget %d", i, peak, total)
+		}
+	}
+	b.mu.Lock()
+	used := b.used
+	b.mu.Unlock()
+	if used != 0 {
+		t.Errorf("budget has %d slots in use after all files closed", used)
+	}
+
+	// A Filer waiting on the Budget is woken by a close in another.
+	f1, err := filers[0].TempFile("", "iox-budget-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := filers[0].Reserve(total-1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := filers[1].TryOpen(f1.Name()); err != ErrFilerBusy {
+		t.Fatalf("TryOpen with budget exhausted: %v, want ErrFilerBusy", err)
+	}
+	opened := make(chan *File)
+	go func() {
+		f2, err := filers[1].Open(f1.Name())
+		if err != nil {
+			t.Error(err)
+		}
+		opened <- f2
+	}()
+	time.Sleep(10 * time.Millisecond)
+	res.Release()
+	f2 := <-opened
+	if f2 != nil {
+		f2.Close()
+	}
+	f1.Close()
+}
@@ -15,15 +15,17 @@
 package iox
 
 import (
+	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
-	"runtime"
 )
 
 // BufferFile creates a buffered file with up to memSize bytes stored in memory.
 //
 // If memSize is zero, the Filer's default value is used.
+// The data beyond memSize is compressed as set by the Filer's
+// BufferCompression.
 //
 // The underlying file descriptor should not be handled directly as the
 // fraction of the contents stored in the OS file may change.
@@ -35,10 +37,11 @@ func (f *Filer) BufferFile(memSize int) *BufferFile {
 		memSize = f.DefaultBufferMemSize
 	}
 	bf := &BufferFile{
-		filer:  f,
-		bufMax: memSize,
+		filer:    f,
+		bufMax:   memSize,
+		compress: f.BufferCompression,
 	}
-	bf.pcN = runtime.Callers(0, bf.pc[:])
+	bf.pc = callers(f)
 	return bf
 }
 
@@ -64,17 +67,20 @@ type BufferFile struct {
 
 	off int64 // kept in sync with pos in *File
 
-	// caller stack at creation
-	pc  [3]uintptr
-	pcN int
+	pc []uintptr // caller stack at creation
+
+	// Used when compress is not CompressionNone, see zwrite.
+	compress Compression
+	zw       *gzip.Writer // writing the compressed stream
+	zr       *gzip.Reader // reading it, once written
+	zoff     int64        // offset of zr in the uncompressed data
 }
 
 func (bf *BufferFile) ensureFile() error {
 	if bf.f == nil {
 		bf.f, bf.err = bf.filer.TempFile("", "bufferfile-", "")
 		if bf.f != nil {
-			bf.f.pcN = bf.pcN
-			bf.f.pc = bf.pc
+			bf.f.setCreator(bf.pc)
 		}
 	}
 	return bf.err
@@ -101,6 +107,18 @@ func (bf *BufferFile) Write(p []byte) (n int, err error) {
 	if len(p) == 0 {
 		return n, nil // done, the write fit in the memory buffer
 	}
+	if bf.compress != CompressionNone {
+		n2, err := bf.zwrite(p)
+		n += n2
+		bf.off += int64(n2)
+		if bf.off-int64(len(bf.buf)) > bf.flen {
+			bf.flen = bf.off - int64(len(bf.buf))
+		}
+		if err != ErrBufferCompressed {
+			bf.err = err
+		}
+		return n, err
+	}
 	n2, err := bf.f.Write(p)
 	bf.err = err
 	n += n2
@@ -123,6 +141,14 @@ func (bf *BufferFile) Read(p []byte) (n int, err error) {
 	if bf.f == nil {
 		return 0, io.EOF
 	}
+	if bf.compress != CompressionNone {
+		n, err = bf.zreadAt(p, bf.off-int64(len(bf.buf)))
+		bf.off += int64(n)
+		if err != io.EOF && err != ErrBufferCompressed {
+			bf.err = err
+		}
+		return n, err
+	}
 	n, err = bf.f.Read(p)
 	bf.off += int64(n)
 	if err != io.EOF {
@@ -146,6 +172,10 @@ func (bf *BufferFile) ReadAt(p []byte, off int64) (n int, err error) {
 		return n, io.EOF
 	}
 	off -= int64(len(bf.buf))
+	if bf.compress != CompressionNone {
+		n2, err := bf.zreadAt(p, off)
+		return n + n2, err
+	}
 	n2, err := bf.f.ReadAt(p, off)
 	n += n2
 	return n, err
@@ -167,11 +197,14 @@ func (bf *BufferFile) Seek(offset int64, whence int) (int64, error) {
 	if offset < 0 {
 		return -1, fmt.Errorf("iox.BufferFile: attempting to seek before beginning of BufferFile (%d)", offset)
 	}
-	if offset < int64(bf.bufMax) {
+	switch {
+	case bf.compress != CompressionNone:
+		// The compressed stream is positioned by zwrite and zreadAt.
+	case offset < int64(bf.bufMax):
 		if bf.f != nil {
 			_, bf.err = bf.f.Seek(0, os.SEEK_SET)
 		}
-	} else {
+	default:
 		bf.ensureFile()
 		_, bf.err = bf.f.Seek(offset-int64(bf.bufMax), os.SEEK_SET)
 	}
@@ -186,12 +219,30 @@ func (bf *BufferFile) Size() int64 {
 	return int64(len(bf.buf)) + bf.flen
 }
 
+// Len returns the number of bytes stored in the buffer file.
+// It is the same as Size.
+func (bf *BufferFile) Len() int64 {
+	return bf.Size()
+}
+
+// Spilled reports whether the contents of the buffer file have
+// outgrown memory and a temporary file has been created.
+func (bf *BufferFile) Spilled() bool {
+	return bf.f != nil
+}
+
 // Truncate changes the file size.
 // It does not move the offset, use Seek for that.
 func (bf *BufferFile) Truncate(size int64) error {
 	if bf.err != nil {
 		return bf.err
 	}
+	if bf.compress != CompressionNone && size >= int64(bf.bufMax) {
+		if size != bf.Size() {
+			return ErrBufferCompressed
+		}
+		return nil
+	}
 	for size > int64(len(bf.buf)) && len(bf.buf) < bf.bufMax {
 		bf.buf = append(bf.buf, 0)
 	}
@@ -207,11 +258,35 @@ func (bf *BufferFile) Truncate(size int64) error {
 		if bf.f != nil {
 			bf.err = bf.f.Truncate(0)
 			bf.flen = 0
+			bf.zreset()
+			if bf.compress != CompressionNone && bf.err == nil {
+				_, bf.err = bf.f.Seek(0, os.SEEK_SET)
+			}
 		}
 	}
 	return bf.err
 }
 
+// Reset empties the BufferFile so it can be reused.
+//
+// The memory buffer and any underlying temporary file are kept,
+// so reusing a BufferFile does not allocate or use a new file descriptor.
+func (bf *BufferFile) Reset() {
+	if bf.err == os.ErrClosed {
+		return
+	}
+	bf.err = nil
+	bf.buf = bf.buf[:0]
+	bf.off = 0
+	if bf.f != nil {
+		bf.flen = 0
+		bf.zreset()
+		if bf.err = bf.f.Truncate(0); bf.err == nil {
+			_, bf.err = bf.f.Seek(0, os.SEEK_SET)
+		}
+	}
+}
+
 // Close closes the BufferFile, deleting any underlying temporary file.
 func (bf *BufferFile) Close() (err error) {
 	if bf == nil {
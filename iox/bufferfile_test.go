@@ -15,7 +15,10 @@
 package iox
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"testing"
@@ -143,3 +146,250 @@ func TestBufferFileNilClose(t *testing.T) {
 		t.Errorf("f.Close()=%v, want os.ErrInvalid", err)
 	}
 }
+
+func TestBufferFileReset(t *testing.T) {
+	filer := NewFiler(1)
+	bf := filer.BufferFile(4)
+	defer bf.Close()
+
+	for _, s := range []string{"hello, world", "ab", "a longer payload"} {
+		if _, err := bf.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bf.Seek(0, os.SEEK_SET); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, bf.Size())
+		if _, err := io.ReadFull(bf, got); err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != s {
+			t.Errorf("read %q, want %q", got, s)
+		}
+		f := bf.f
+		bf.Reset()
+		if bf.Size() != 0 {
+			t.Errorf("after Reset Size()=%d, want 0", bf.Size())
+		}
+		if bf.f != f {
+			t.Error("Reset replaced the temporary file")
+		}
+	}
+	if open := filer.Stats().Open; open != 1 {
+		t.Errorf("Open=%d, want 1", open)
+	}
+}
+
+func benchmarkBufferFile(b *testing.B, reuse bool) {
+	filer := NewFiler(1)
+	data := make([]byte, 8192)
+
+	bf := filer.BufferFile(4096)
+	for i := 0; i < b.N; i++ {
+		if _, err := bf.Write(data); err != nil {
+			b.Fatal(err)
+		}
+		if reuse {
+			bf.Reset()
+		} else {
+			bf.Close()
+			bf = filer.BufferFile(4096)
+		}
+	}
+	bf.Close()
+}
+
+func BenchmarkBufferFileReset(b *testing.B) { benchmarkBufferFile(b, true) }
+func BenchmarkBufferFileNew(b *testing.B)   { benchmarkBufferFile(b, false) }
+
+func TestBufferFileLenSpilled(t *testing.T) {
+	filer := NewFiler(1)
+	bf := filer.BufferFile(4)
+	defer bf.Close()
+
+	if _, err := bf.Write([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if n := bf.Len(); n != 3 {
+		t.Errorf("Len()=%d, want 3", n)
+	}
+	if bf.Spilled() {
+		t.Error("small BufferFile reports Spilled")
+	}
+	if _, err := bf.Write([]byte("defg")); err != nil {
+		t.Fatal(err)
+	}
+	if n := bf.Len(); n != 7 {
+		t.Errorf("Len()=%d, want 7", n)
+	}
+	if !bf.Spilled() {
+		t.Error("large BufferFile does not report Spilled")
+	}
+}
+
+func TestBufferFileBoundary(t *testing.T) {
+	filer := NewFiler(1)
+	bf := filer.BufferFile(8)
+
+	if _, err := bf.Write([]byte("0123456789abcdef")); err != nil {
+		t.Fatal(err)
+	}
+	if !bf.Spilled() {
+		t.Fatal("16 bytes in an 8 byte BufferFile did not spill")
+	}
+	read := func(off int64, whence, n int) string {
+		t.Helper()
+		if _, err := bf.Seek(off, whence); err != nil {
+			t.Fatal(err)
+		}
+		p := make([]byte, n)
+		if _, err := io.ReadFull(bf, p); err != nil {
+			t.Fatal(err)
+		}
+		invariants(t, bf)
+		return string(p)
+	}
+	for _, test := range []struct {
+		off    int64
+		whence int
+		n      int
+		want   string
+	}{
+		{off: 5, whence: io.SeekStart, n: 6, want: "56789a"},  // memory into disk
+		{off: 8, whence: io.SeekStart, n: 2, want: "89"},      // at the boundary
+		{off: -3, whence: io.SeekCurrent, n: 4, want: "789a"}, // back across it
+		{off: 2, whence: io.SeekStart, n: 3, want: "234"},     // back into memory from disk
+		{off: -4, whence: io.SeekEnd, n: 4, want: "cdef"},
+	} {
+		if got := read(test.off, test.whence, test.n); got != test.want {
+			t.Errorf("Seek(%d, %d) then read %d bytes: %q, want %q", test.off, test.whence, test.n, got, test.want)
+		}
+	}
+
+	p := make([]byte, 4)
+	if _, err := bf.ReadAt(p, 6); err != nil || string(p) != "6789" {
+		t.Errorf("ReadAt across the boundary: %q, %v; want \"6789\"", p, err)
+	}
+
+	// A write across the boundary lands on both sides of it.
+	if _, err := bf.Seek(6, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bf.Write([]byte("WXYZ")); err != nil {
+		t.Fatal(err)
+	}
+	invariants(t, bf)
+	if got, want := read(0, io.SeekStart, 16), "012345WXYZabcdef"; got != want {
+		t.Errorf("after write across the boundary read %q, want %q", got, want)
+	}
+
+	if err := bf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if open := filer.Stats().Open; open != 0 {
+		t.Errorf("Open=%d after Close, want 0", open)
+	}
+}
+
+func TestBufferFileSpill(t *testing.T) {
+	filer := NewFiler(2)
+
+	bf := filer.BufferFile(64 << 10)
+	f, err := filer.TempFile("", "cmpfile-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spilled := false
+	ft := &ioxtest.Tester{
+		F1:        bf,
+		F2:        f,
+		T:         t,
+		Rand:      testRand,
+		MaxSize:   16 << 10,
+		NumEvents: 256,
+		Size:      1 << 20,
+		Invariants: func() {
+			invariants(t, bf)
+			spilled = spilled || bf.Spilled()
+		},
+	}
+	ft.Run()
+
+	if !spilled {
+		t.Error("1MB payload did not spill")
+	}
+	if err := bf.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBufferFileCompression(t *testing.T) {
+	filer := NewFiler(1)
+	filer.BufferCompression = CompressionGzip
+	bf := filer.BufferFile(1 << 10)
+	defer bf.Close()
+
+	var want bytes.Buffer
+	for i := 0; want.Len() < 1<<20; i++ {
+		fmt.Fprintf(&want, "%d: log line that compresses well\n", i)
+	}
+	for b := want.Bytes(); len(b) > 0; {
+		n := 1000
+		if n > len(b) {
+			n = len(b)
+		}
+		if _, err := bf.Write(b[:n]); err != nil {
+			t.Fatal(err)
+		}
+		b = b[n:]
+	}
+	if got := bf.Size(); got != int64(want.Len()) {
+		t.Fatalf("Size()=%d, want %d", got, want.Len())
+	}
+
+	if _, err := bf.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(bf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Fatalf("read back %d bytes, do not match the %d written", len(got), want.Len())
+	}
+	fi, err := bf.f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() >= bf.Size()/2 {
+		t.Errorf("temp file is %d bytes, want well under the %d written", fi.Size(), bf.Size())
+	}
+
+	// Reads at other offsets work, if slowly.
+	p := make([]byte, 100)
+	for _, off := range []int64{500000, 1000, 100000} {
+		if _, err := bf.ReadAt(p, off); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(p, want.Bytes()[off:off+100]) {
+			t.Errorf("ReadAt(%d)=%q, want %q", off, p, want.Bytes()[off:off+100])
+		}
+	}
+
+	// The compressed data cannot be modified, until Reset.
+	if _, err := bf.Write([]byte("more")); err != ErrBufferCompressed {
+		t.Errorf("Write after read-back: %v, want ErrBufferCompressed", err)
+	}
+	if err := bf.Truncate(5000); err != ErrBufferCompressed {
+		t.Errorf("Truncate into compressed data: %v, want ErrBufferCompressed", err)
+	}
+	bf.Reset()
+	if _, err := bf.Write(want.Bytes()[:5000]); err != nil {
+		t.Fatal(err)
+	}
+	bf.Seek(0, io.SeekStart)
+	if got, err := ioutil.ReadAll(bf); err != nil || !bytes.Equal(got, want.Bytes()[:5000]) {
+		t.Errorf("after Reset read %d bytes, %v; want the 5000 written", len(got), err)
+	}
+}
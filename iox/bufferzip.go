@@ -0,0 +1,112 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Compression is how a BufferFile compresses the data it spills to
+// its temporary file.
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+
+	// CompressionGzip writes the part of a BufferFile beyond memory
+	// through a gzip stream, and reads it back by decompressing from
+	// the start of the stream.
+	//
+	// Writes to the compressed part can only append, and only until it
+	// is first read. Reads may be at any offset, but only sequential
+	// reads are efficient: reading backwards restarts decompression.
+	// Truncate is only possible to the current size or to a size that
+	// fits in memory. Operations that are not possible report
+	// ErrBufferCompressed. Reset lifts all of these restrictions.
+	CompressionGzip
+)
+
+// ErrBufferCompressed is returned by BufferFile methods that cannot
+// be done on the compressed part of a BufferFile.
+var ErrBufferCompressed = errors.New("iox.BufferFile: operation not supported on compressed data")
+
+// zwrite appends p to the compressed part of the file.
+func (bf *BufferFile) zwrite(p []byte) (int, error) {
+	if bf.zr != nil || bf.off != int64(len(bf.buf))+bf.flen {
+		return 0, ErrBufferCompressed
+	}
+	if bf.zw == nil {
+		bf.zw = gzip.NewWriter(bf.f)
+	}
+	return bf.zw.Write(p)
+}
+
+// zreadAt reads the compressed part of the file from off.
+func (bf *BufferFile) zreadAt(p []byte, off int64) (n int, err error) {
+	if bf.zw != nil {
+		// Done writing: finish the stream and read from its start.
+		if err := bf.zw.Close(); err != nil {
+			return 0, err
+		}
+		bf.zw = nil
+		if bf.zr, err = bf.zreader(); err != nil {
+			return 0, err
+		}
+	}
+	if bf.zr == nil || off >= bf.flen {
+		return 0, io.EOF
+	}
+	if off < bf.zoff {
+		if bf.zr, err = bf.zreader(); err != nil {
+			return 0, err
+		}
+		bf.zoff = 0
+	}
+	if off > bf.zoff {
+		skipped, err := io.CopyN(ioutil.Discard, bf.zr, off-bf.zoff)
+		bf.zoff += skipped
+		if err != nil {
+			return 0, err
+		}
+	}
+	if max := bf.flen - off; int64(len(p)) > max {
+		p = p[:max]
+	}
+	n, err = io.ReadFull(bf.zr, p)
+	bf.zoff += int64(n)
+	if err == nil && off+int64(n) == bf.flen {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// zreader returns a reader decompressing from the start of the file.
+func (bf *BufferFile) zreader() (*gzip.Reader, error) {
+	if _, err := bf.f.Seek(0, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+	return gzip.NewReader(bf.f)
+}
+
+// zreset discards the compressed part of the file.
+func (bf *BufferFile) zreset() {
+	bf.zw = nil
+	bf.zr = nil
+	bf.zoff = 0
+}
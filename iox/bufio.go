@@ -0,0 +1,67 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import "bufio"
+
+// A BufWriteCloser is a bufio.Writer that owns its File.
+// Close flushes the buffer and then closes the File.
+type BufWriteCloser struct {
+	*bufio.Writer
+	file *File
+}
+
+// BufferedWriter returns a buffered writer for the file sized by the
+// Filer's DefaultBufferMemSize. Closing it flushes and closes the file,
+// so buffered data cannot be lost by closing the File first.
+// The file should not be written to directly while it is in use.
+func (file *File) BufferedWriter() *BufWriteCloser {
+	return &BufWriteCloser{
+		Writer: bufio.NewWriterSize(file, file.filer.DefaultBufferMemSize),
+		file:   file,
+	}
+}
+
+// Close flushes buffered data and closes the File.
+// The File is closed even if the flush fails, and the flush error
+// is reported in preference to the close error.
+func (w *BufWriteCloser) Close() error {
+	err := w.Flush()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// A BufReadCloser is a bufio.Reader that owns its File.
+// Close closes the File.
+type BufReadCloser struct {
+	*bufio.Reader
+	file *File
+}
+
+// BufferedReader returns a buffered reader for the file sized by the
+// Filer's DefaultBufferMemSize. Closing it closes the file.
+func (file *File) BufferedReader() *BufReadCloser {
+	return &BufReadCloser{
+		Reader: bufio.NewReaderSize(file, file.filer.DefaultBufferMemSize),
+		file:   file,
+	}
+}
+
+// Close closes the File.
+func (r *BufReadCloser) Close() error {
+	return r.file.Close()
+}
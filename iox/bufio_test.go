@@ -0,0 +1,100 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBufferedWriter(t *testing.T) {
+	filer := NewFilerWithOptions(1, WithBufferMemSize(1<<10))
+	name := filepath.Join(t.TempDir(), "buffered")
+
+	f, err := filer.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Repeat("0123456789", 250)
+	w := f.BufferedWriter()
+	if w.Size() != 1<<10 {
+		t.Errorf("buffer size %d, want %d", w.Size(), 1<<10)
+	}
+	for _, s := range []string{want[:len(want)-5], want[len(want)-5:]} {
+		if _, err := w.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w.Buffered() == 0 {
+		t.Fatal("no data left buffered, test is not exercising Close")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("%d files open after Close, want 0", got)
+	}
+
+	got, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("file has %d bytes, want %d", len(got), len(want))
+	}
+
+	f, err = filer.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := f.BufferedReader()
+	line, err := r.ReadString('9')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "0123456789" {
+		t.Errorf("ReadString=%q", line)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Read(make([]byte, 1)); err == nil {
+		t.Error("File readable after BufReadCloser.Close")
+	}
+}
+
+func TestBufferedWriterFlushError(t *testing.T) {
+	filer := NewFiler(1)
+	name := filepath.Join(t.TempDir(), "ro")
+	if err := ioutil.WriteFile(name, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := filer.Open(name) // read-only, so the flush fails
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := f.BufferedWriter()
+	w.Write(bytes.Repeat([]byte("x"), 10))
+	if err := w.Close(); err == nil {
+		t.Error("Close of read-only file reported no flush error")
+	}
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("%d files open after failed Close, want 0", got)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"fmt"
+	"os/exec"
+	"testing"
+)
+
+// childHasFD reports whether a child process sees the descriptor fd.
+func childHasFD(t *testing.T, fd uintptr) bool {
+	t.Helper()
+	err := exec.Command("/bin/sh", "-c", fmt.Sprintf("test -e /proc/self/fd/%d", fd)).Run()
+	if err == nil {
+		return true
+	}
+	if _, ok := err.(*exec.ExitError); ok {
+		return false
+	}
+	t.Fatal(err)
+	return false
+}
+
+func TestFilerInheritFDs(t *testing.T) {
+	for _, inherit := range []bool{false, true} {
+		filer := NewFiler(2)
+		filer.InheritFDs = inherit
+		f, err := filer.TempFile("", "iox-cloexec-", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := childHasFD(t, f.Fd()); got != inherit {
+			t.Errorf("InheritFDs=%v: child has fd %d: %v", inherit, f.Fd(), got)
+		}
+		f.Close()
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import "os"
+
+// copyFile copies src to dst.
+//
+// Files that fit in buf are copied through it. Larger files are
+// copied with os.File.ReadFrom, which tries copy_file_range (and then
+// other in-kernel copies) and falls back to a userspace copy itself
+// when the kernel cannot copy between the two files, for example
+// across filesystems.
+func copyFile(dst, src *os.File, buf []byte) (int64, error) {
+	if fi, err := src.Stat(); err == nil && fi.Size() <= int64(len(buf)) {
+		return bufferedCopy(dst, src, buf)
+	}
+	return dst.ReadFrom(src)
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// TestFilerCopyFileCrossFS copies between tmpfs and the temp directory,
+// where the kernel may refuse copy_file_range and the copy falls back.
+func TestFilerCopyFileCrossFS(t *testing.T) {
+	shm, err := ioutil.TempDir("/dev/shm", "iox-")
+	if err != nil {
+		t.Skipf("no /dev/shm: %v", err)
+	}
+	defer os.RemoveAll(shm)
+	dir, err := ioutil.TempDir("", "iox-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var st1, st2 syscall.Stat_t
+	if err := syscall.Stat(shm, &st1); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Stat(dir, &st2); err != nil {
+		t.Fatal(err)
+	}
+	if st1.Dev == st2.Dev {
+		t.Skip("/dev/shm and temp dir are on the same filesystem")
+	}
+
+	data := []byte("across filesystems")
+	src := shm + "/src"
+	if err := ioutil.WriteFile(src, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	testCopyFile(t, NewFiler(2), dir+"/dst", src, data)
+}
@@ -26,4 +26,12 @@
 // A BufferFile keeps a fraction of its contents in memory.
 // If the number of bytes stored in a BufferFile is small, no file
 // descriptor is ever used.
+//
+// Failures are reported with errors that can be tested for with
+// errors.Is: ErrFilerBusy when a non-blocking open finds no free
+// file descriptor, ErrFilerTimeout when an open times out waiting
+// for one, the context's error when it is canceled, ErrFilerClosed
+// after Shutdown, os.ErrClosed for a second Close, and
+// ErrFileTooLarge for a Truncate above MaxFileSize. Errors from the
+// operating system are passed on as the os package returns them.
 package iox // import "github.com/moleculer-go/sqlite/iox"
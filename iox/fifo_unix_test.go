@@ -0,0 +1,118 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package iox
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFilerOpenFIFO(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "fifo")
+	if err := syscall.Mkfifo(name, 0600); err != nil {
+		t.Skipf("mkfifo: %v", err)
+	}
+	filer := NewFiler(4)
+
+	// With O_NONBLOCK the read end opens without a writer.
+	r1, err := filer.OpenFile(name, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r1.Close()
+	if s := filer.Stats(); s.Open != 1 || s.Opening != 0 {
+		t.Errorf("after non-blocking open Stats()=%+v, want 1 open, 0 opening", s)
+	}
+
+	// Without it, a writer blocks until there is a reader, and a
+	// reader until there is a writer: open a reader in the background.
+	opened := make(chan *File)
+	go func() {
+		r2, err := filer.OpenFile(name, os.O_RDONLY, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		opened <- r2
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for filer.Stats().Opening != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Stats()=%+v, want 1 opening", filer.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if s := filer.Stats(); s.Open != 2 {
+		t.Errorf("with a blocked open Stats()=%+v, want 2 open", s)
+	}
+
+	w, err := filer.OpenFile(name, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if r2 := <-opened; r2 != nil {
+		defer r2.Close()
+	}
+	if s := filer.Stats(); s.Open != 3 || s.Opening != 0 {
+		t.Errorf("after open completed Stats()=%+v, want 3 open, 0 opening", s)
+	}
+}
+
+func TestFileCloseUnblocksRead(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	filer := NewFiler(1)
+	f, err := filer.Adopt(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readErr := make(chan error)
+	go func() {
+		_, err := f.Read(make([]byte, 1))
+		readErr <- err
+	}()
+	time.Sleep(20 * time.Millisecond) // let Read block
+
+	closed := make(chan error)
+	go func() { closed <- f.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked by a pending Read")
+	}
+	select {
+	case err := <-readErr:
+		if err == nil {
+			t.Error("Read of closed pipe succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read not interrupted by Close")
+	}
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("%d files open after Close, want 0", got)
+	}
+}
@@ -16,72 +16,351 @@ package iox
 
 import (
 	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
+// ErrFilerBusy is returned by TryOpen and TryOpenFile when the Filer
+// has no free file descriptors.
+var ErrFilerBusy = errors.New("iox: Filer has no free file descriptors")
+
+// ErrFilerClosed is returned when opening a file after Shutdown
+// has been called on the Filer.
+var ErrFilerClosed = errors.New("iox: Filer is shut down")
+
+// ErrTooManyTempFiles is returned when creating a temporary file
+// while Filer.MaxTempFiles are open and FailAtMaxTempFiles is set.
+var ErrTooManyTempFiles = errors.New("iox: Filer has MaxTempFiles temporary files open")
+
+// ErrFileTooLarge is returned by File.Truncate for a size
+// above the Filer's MaxFileSize.
+var ErrFileTooLarge = errors.New("iox: file size exceeds Filer.MaxFileSize")
+
+// ErrFilerTimeout is returned when an open gives up waiting for a
+// file descriptor, because the deadline of its context passed or it
+// waited for longer than Filer.MaxOpenWait. It wraps
+// context.DeadlineExceeded, so errors.Is matches either.
+var ErrFilerTimeout = fmt.Errorf("iox: timed out waiting for a file descriptor: %w", context.DeadlineExceeded)
+
 // A Filer creates files, managing load on file descriptors.
 //
+// When all of its file descriptors are in use, opens block and are
+// given descriptors in the order they arrived, so no open is starved.
+//
 // Exported fields can only be modified after NewFiler is called
 // and before any methods are called.
 type Filer struct {
 	DefaultBufferMemSize int // default value: 64kb
 
+	// BufferCompression is how BufferFiles compress the data that
+	// does not fit in memory. Compressed BufferFiles are intended to
+	// be written and then read back in order, see CompressionGzip.
+	BufferCompression Compression
+	TempRetries       int // attempts to find an unused temp name, default: 1000
+
+	// TempNameFunc, if non-nil, returns the base name to try for a
+	// new temporary file in place of prefix, a random string, and
+	// suffix. If the name exists it is called again, up to
+	// TempRetries times, so it should not return the same name twice.
+	TempNameFunc func(prefix, suffix string) string
+
+	// MaxTempFiles, if positive, limits the number of temporary
+	// files open at once, so they can be throttled separately from
+	// other files. Creating another waits until one is closed, or
+	// with FailAtMaxTempFiles set, fails with ErrTooManyTempFiles.
+	// Other opens are not affected.
+	MaxTempFiles       int
+	FailAtMaxTempFiles bool
+
+	// CallerDepth is the number of stack frames recorded when a
+	// file is opened, used to report who opened it at Shutdown and
+	// by WarnLeaks and OpenFiles. Frames inside the Filer are not
+	// counted, so the default of 3 reports the caller and two of its
+	// callers. Raise it when files are opened through layers of helpers.
+	CallerDepth int
+
+	// MaxFileSize, if positive, is the largest size File.Truncate
+	// will give a file, so a bad size cannot create a huge sparse
+	// file that later fills the disk.
+	MaxFileSize int64
+
+	// MaxOpenWait, if positive, bounds how long an open waits for a
+	// file descriptor before failing with ErrFilerTimeout. It applies
+	// to every open, including those with a context.
+	MaxOpenWait time.Duration
+
+	// DefaultOpenDeadline, if positive, bounds how long an open
+	// waits for a file descriptor before failing with
+	// ErrFilerTimeout. It applies to plain opens such as Open and
+	// TempFile, and to those with a context. If the context has a
+	// deadline, the shorter of the two applies, and MaxOpenWait,
+	// if shorter still, applies as well.
+	DefaultOpenDeadline time.Duration
+
+	// HighWaterPct, if positive, logs a warning when the number of
+	// open files reaches that percentage of the limit. It warns once,
+	// and not again until usage has fallen 10 points below.
+	HighWaterPct int
+
+	// OpenBreaker, if its Threshold is positive, makes opens fail
+	// fast with ErrBreakerOpen after repeated failures.
+	OpenBreaker BreakerConfig
+
 	Logf func(format string, v ...interface{}) // used to report open files at Shutdown
 
+	// Logger, if non-nil, is used instead of Logf. Events are logged
+	// as structured records with "event", "file", and "creator"
+	// attributes.
+	Logger *slog.Logger
+
+	// WarnLeaks, if set, reports via Logger or Logf any File that is garbage
+	// collected without being closed, and then closes it.
+	// It adds GC overhead to every File and is intended for debugging.
+	WarnLeaks bool
+
+	// OnOpen, if non-nil, is called after a file is opened.
+	// OnClose, if non-nil, is called after a file is closed with
+	// the duration it was open.
+	// Neither is called with any Filer locks held.
+	OnOpen  func(name string)
+	OnClose func(name string, openDuration time.Duration)
+
+	// OnTempRemove, if non-nil, is called when Close removes a
+	// temporary file, with its size when closed (-1 if it could not
+	// be found) and how long it was open. It is not called with any
+	// Filer locks held.
+	OnTempRemove func(name string, size int64, lifetime time.Duration)
+
+	// OnWait, if non-nil, is called when an open that had to wait
+	// for a file descriptor is given one, with the time it waited.
+	// It is not called for opens that did not wait, or that gave up.
+	OnWait func(waited time.Duration)
+
+	// Tracer, if non-nil, is used to trace opens, with a span for
+	// each open and a child span for any wait for a file descriptor.
+	Tracer Tracer
+
+	// OnForceClose, if non-nil, is called by Shutdown for each file
+	// it is about to close because its context is done, so buffered
+	// data can be written out first. It is called without any Filer
+	// locks held, and may use or close the file. The *File may not
+	// be the one returned when the file was opened. Shutdown waits
+	// for OnForceClose to return.
+	OnForceClose func(file *File)
+
+	// InheritFDs, if set, lets child processes inherit the files
+	// the Filer opens.
+	//
+	// By default files are not inherited: on Unix the os package
+	// opens every file with O_CLOEXEC, and on Windows handles are
+	// not inheritable. Setting InheritFDs clears FD_CLOEXEC on
+	// Linux and the BSDs (including macOS). It has no effect on
+	// other platforms.
+	InheritFDs bool
+
+	// KeepTempOnError, if set, makes Close keep temporary files
+	// marked with File.MarkKeep instead of removing them, and log
+	// their names, so a failed spill can be inspected.
+	KeepTempOnError bool
+
+	// ManualTempCleanup, if set, makes Close leave temporary files in
+	// place. The Filer remembers their names, and RemoveAllTemp
+	// removes them all.
+	ManualTempCleanup bool
+
+	// CreateTempdir, if set, makes TempFile and TempDir create the
+	// temp directory, and any missing parents, if it does not exist.
+	CreateTempdir bool
+
+	fs      fileSystem
 	tempdir string
+	jail    string // root of a Filer made by NewJailedFiler
 
 	shuttingDown chan struct{} // closed on shutdown
 
-	mu      sync.Mutex
-	cond    *sync.Cond
-	files   map[*File]struct{}
-	fdlimit int
-	seed    uint32
+	// The first Shutdown runs once, later ones return its result.
+	shutdownOnce   sync.Once
+	shutdownForced []string
+	shutdownErr    error
+
+	mu   sync.Mutex
+	cond *sync.Cond // broadcast when a file is closed
+
+	tempCond  *sync.Cond // broadcast when a temporary file is closed
+	tempCount int        // temporary files open or being created
+	files     map[*fileState]struct{}
+	fdlimit   int
+	waitq     []*waiter  // blocked in newFile, by priority then FIFO
+	peak      int        // high-water mark of len(files)
+	warned    bool       // HighWaterPct warning given
+	highWater *highWater // warning to log once mu is released, see unlock
+	paused    bool       // opens wait, see Pause
+	forced    bool       // Shutdown closed files; opens in progress fail
+
+	reserved  int                 // slots held by reservations
+	seed      uint32              // accessed atomically, see seedRand
+	randFunc  func() string       // replaces rand, for tests
+	tempNames map[string]struct{} // left for RemoveAllTemp, see ManualTempCleanup
+
+	budget   *Budget // shared limit, see NewFilerWithBudget
+	budgeted int     // slots taken from budget, guarded by mu
+
+	bufPool sync.Pool // of *[]byte, see getBuf
+	breaker breaker   // see OpenBreaker
+
+	idleTimeout time.Duration
+	sweeping    bool // sweepIdle is running
 }
 
 // NewFiler creates a Filer which will open at most fdLimit files simultaneously.
 // If fdLimit is 0, a Filer is limited to 90% of the process's allowed files.
 func NewFiler(fdLimit int) *Filer {
+	return NewFilerWithOptions(fdLimit)
+}
+
+// An Option configures a Filer created by NewFilerWithOptions.
+type Option func(*Filer)
+
+// WithTempdir sets the default directory used to hold temporary files.
+func WithTempdir(dir string) Option {
+	return func(f *Filer) { f.tempdir = dir }
+}
+
+// WithLogf sets the Filer's Logf.
+func WithLogf(logf func(format string, v ...interface{})) Option {
+	return func(f *Filer) { f.Logf = logf }
+}
+
+// WithLogger sets the Filer's Logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(f *Filer) { f.Logger = logger }
+}
+
+// WithBufferMemSize sets the Filer's DefaultBufferMemSize.
+func WithBufferMemSize(size int) Option {
+	return func(f *Filer) { f.DefaultBufferMemSize = size }
+}
+
+// NewFilerWithOptions is NewFiler with the options applied before the
+// Filer is returned, so there is no window in which it is in use
+// but not yet configured.
+func NewFilerWithOptions(fdLimit int, opts ...Option) *Filer {
 	if fdLimit == 0 {
-		var lim syscall.Rlimit
-		syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim)
-		fdLimit = int(lim.Max - (lim.Max / 10))
-	}
-	if fdLimit == 0 {
-		fdLimit = 90 // getrlimit failed, guess
+		fdLimit = defaultFDLimit()
 	}
 	filer := &Filer{
 		DefaultBufferMemSize: 1 << 16,
+		TempRetries:          1000,
+		CallerDepth:          3,
 
+		fs:           osFileSystem{},
 		tempdir:      os.TempDir(),
 		shuttingDown: make(chan struct{}),
-		files:        make(map[*File]struct{}),
+		files:        make(map[*fileState]struct{}),
 		fdlimit:      fdLimit,
 	}
 	filer.cond = sync.NewCond(&filer.mu)
+	filer.tempCond = sync.NewCond(&filer.mu)
+	for _, opt := range opts {
+		opt(filer)
+	}
 	return filer
 }
 
+// Derive creates a Filer for a part of a program, with the same
+// configuration as f but its own limit of fdLimit files.
+//
+// The new Filer shares f's tempdir, exported fields, and idle timeout
+// as they are when Derive is called, and later changes to either do
+// not affect the other. Its files are accounted separately: they do
+// not count against f's limit, unless f was created with
+// NewFilerWithBudget, in which case the new Filer draws from the
+// same Budget. It is also shut down separately: Shutdown on f does
+// not shut down Filers derived from it.
+func (f *Filer) Derive(fdLimit int) *Filer {
+	d := NewFilerWithOptions(fdLimit)
+	d.DefaultBufferMemSize = f.DefaultBufferMemSize
+	d.BufferCompression = f.BufferCompression
+	d.TempRetries = f.TempRetries
+	d.TempNameFunc = f.TempNameFunc
+	d.MaxTempFiles = f.MaxTempFiles
+	d.FailAtMaxTempFiles = f.FailAtMaxTempFiles
+	d.CallerDepth = f.CallerDepth
+	d.MaxFileSize = f.MaxFileSize
+	d.MaxOpenWait = f.MaxOpenWait
+	d.DefaultOpenDeadline = f.DefaultOpenDeadline
+	d.HighWaterPct = f.HighWaterPct
+	d.OpenBreaker = f.OpenBreaker
+	d.Logf = f.Logf
+	d.Logger = f.Logger
+	d.WarnLeaks = f.WarnLeaks
+	d.OnOpen = f.OnOpen
+	d.OnClose = f.OnClose
+	d.OnWait = f.OnWait
+	d.Tracer = f.Tracer
+	d.OnForceClose = f.OnForceClose
+	d.OnTempRemove = f.OnTempRemove
+	d.InheritFDs = f.InheritFDs
+	d.KeepTempOnError = f.KeepTempOnError
+	d.ManualTempCleanup = f.ManualTempCleanup
+	d.CreateTempdir = f.CreateTempdir
+	d.fs = f.fs
+	d.tempdir = f.tempdir
+	d.jail = f.jail
+	d.budget = f.budget
+
+	f.mu.Lock()
+	idle := f.idleTimeout
+	f.mu.Unlock()
+	if idle > 0 {
+		d.SetIdleTimeout(idle)
+	}
+	return d
+}
+
 // SetTempdir sets the default directory used to hold temporary files.
+// Prefer WithTempdir, which sets it before the Filer can be used.
 func (f *Filer) SetTempdir(tempdir string) {
 	// TODO: just export tempdir field?
 	f.tempdir = tempdir
 }
 
+// SetFDLimit changes the maximum number of files the Filer will open
+// simultaneously.
+//
+// Unlike NewFiler, a limit of zero (or less) is invalid and is ignored.
+// If the new limit is below the number of files currently open, no files
+// are closed, new opens block until enough files are closed.
+func (f *Filer) SetFDLimit(n int) {
+	if n <= 0 {
+		return
+	}
+	f.mu.Lock()
+	f.fdlimit = n
+	f.grantLocked()
+	f.unlock()
+}
+
 // Open opens the named file for reading.
 //
 // It is similar to os.Open except it will block if Filer has exhasted
 // its file descriptors until one is available.
 func (f *Filer) Open(name string) (*File, error) {
-	file, err := f.openFile(name, os.O_RDONLY, 0)
+	file, err := f.openFile(context.Background(), name, os.O_RDONLY, 0, openOptions{origin: OriginOpenRead})
 	if file != nil {
-		file.pcN = runtime.Callers(0, file.pc[:])
+		file.setCreator(callers(f))
 	}
 	return file, err
 }
@@ -91,179 +370,1473 @@ func (f *Filer) Open(name string) (*File, error) {
 // It is similar to os.OpenFile except it will block if Filer has exhasted
 // its file descriptors until one is available.
 func (f *Filer) OpenFile(name string, flag int, perm os.FileMode) (*File, error) {
-	file, err := f.openFile(name, flag, perm)
+	file, err := f.openFile(context.Background(), name, flag, perm, openOptions{origin: OriginOpenGeneral})
+	if file != nil {
+		file.setCreator(callers(f))
+	}
+	return file, err
+}
+
+// OpenContext is OpenFile with a context.
+//
+// If the Filer has exhausted its file descriptors, OpenContext blocks
+// until one is available or ctx is done. If the deadline of ctx passes
+// while waiting it returns ErrFilerTimeout, otherwise ctx.Err().
+func (f *Filer) OpenContext(ctx context.Context, name string, flag int, perm os.FileMode) (*File, error) {
+	file, err := f.openFile(ctx, name, flag, perm, openOptions{origin: OriginOpenGeneral})
 	if file != nil {
-		file.pcN = runtime.Callers(0, file.pc[:])
+		file.setCreator(callers(f))
 	}
 	return file, err
 }
 
-func (f *Filer) openFile(name string, flag int, perm os.FileMode) (*File, error) {
-	file := f.newFile()
-	if file == nil {
-		return nil, context.Canceled
+// TryOpen opens the named file for reading without blocking.
+//
+// It is similar to Open except that if the Filer has exhausted its
+// file descriptors it returns ErrFilerBusy.
+func (f *Filer) TryOpen(name string) (*File, error) {
+	file, err := f.openFile(context.Background(), name, os.O_RDONLY, 0, openOptions{noWait: true, origin: OriginOpenRead})
+	if file != nil {
+		file.setCreator(callers(f))
+	}
+	return file, err
+}
+
+// TryOpenFile is OpenFile without blocking.
+//
+// If the Filer has exhausted its file descriptors it returns ErrFilerBusy.
+func (f *Filer) TryOpenFile(name string, flag int, perm os.FileMode) (*File, error) {
+	file, err := f.openFile(context.Background(), name, flag, perm, openOptions{noWait: true, origin: OriginOpenGeneral})
+	if file != nil {
+		file.setCreator(callers(f))
+	}
+	return file, err
+}
+
+// OpenFilePriority is OpenFile for callers that should not wait
+// behind less important work.
+//
+// When the Filer has exhausted its file descriptors, blocked opens are
+// served in order of priority, highest first, and then in the order
+// they arrived. Other open methods use priority 0.
+func (f *Filer) OpenFilePriority(name string, flag int, perm os.FileMode, prio int) (*File, error) {
+	file, err := f.openFile(context.Background(), name, flag, perm, openOptions{priority: prio, origin: OriginOpenGeneral})
+	if file != nil {
+		file.setCreator(callers(f))
+	}
+	return file, err
+}
+
+// openOptions modify how openFile acquires a file descriptor slot.
+type openOptions struct {
+	noWait   bool         // return ErrFilerBusy instead of waiting
+	priority int          // see OpenFilePriority
+	res      *Reservation // take a slot from res, never waiting
+
+	origin FileOrigin // set by each open method, see FileOrigin
+}
+
+func (f *Filer) openFile(ctx context.Context, name string, flag int, perm os.FileMode, opts openOptions) (file *File, err error) {
+	if f.Tracer != nil {
+		var end func(error)
+		ctx, end = f.Tracer.StartSpan(ctx, "iox.Filer.Open")
+		defer func() { end(err) }()
+	}
+	if f.jail != "" {
+		if name, err = f.jailPath("open", name); err != nil {
+			return nil, err
+		}
 	}
-	osfile, err := os.OpenFile(name, flag, perm)
+	file, err = f.newFile(ctx, opts)
 	if err != nil {
-		file.remove()
 		return nil, err
 	}
-	file.File = osfile
+	if err := file.open(name, flag, perm); err != nil {
+		if opts.res != nil {
+			f.undraw(file.fileState, opts.res)
+		} else {
+			file.remove()
+		}
+		return nil, err
+	}
 	return file, nil
 }
 
-func (f *Filer) TempFile(dir, prefix, suffix string) (file *File, err error) {
-	if dir == "" {
-		dir = f.tempdir
+// open opens the named file as file, which already holds a slot.
+// If it fails the slot is still held.
+func (file *File) open(name string, flag int, perm os.FileMode) error {
+	f := file.filer
+	probe, err := f.breaker.allow(&f.OpenBreaker)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: name, Err: err}
 	}
-	for i := 0; i < 1000; i++ {
-		name := filepath.Join(dir, prefix+f.rand()+suffix)
-		file, err = f.openFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
-		if os.IsExist(err) {
-			continue
+	file.setOpening(true)
+	osfile, err := openRetry(f.fs, name, flag, perm)
+	for i := 0; i < fdExhaustedRetries && fdExhausted(err); i++ {
+		// The process is out of descriptors, perhaps used outside
+		// the Filer. Give a closing file a moment to free one.
+		f.waitClose(fdExhaustedBackoff << uint(i))
+		osfile, err = openRetry(f.fs, name, flag, perm)
+	}
+	file.setOpening(false)
+	f.breaker.done(&f.OpenBreaker, probe, err)
+	if err != nil {
+		return err
+	}
+	if file.filer.InheritFDs {
+		if err := setInherit(osfile); err != nil {
+			osfile.Close()
+			return err
 		}
-		break
 	}
-	if file != nil {
-		file.pcN = runtime.Callers(0, file.pc[:])
-		file.isTemp = true
+	file.openName, file.openFlag, file.openPerm = name, flag, perm
+	if err := file.setOpened(osfile, name); err != nil {
+		osfile.Close()
+		return err
 	}
-	return file, err
+	return nil
 }
 
-// Shutdown gracefully shuts down the Filer.
-// Any active files continue to work until the passed context is done.
-// At that point they are explicitly closed and further operations return errors.
-// Shutdown returns the error from ctx.
-func (f *Filer) Shutdown(ctx context.Context) error {
-	close(f.shuttingDown)
-	f.cond.Broadcast()
-	done := make(chan struct{})
+// openEINTRRetries is how many times openRetry tries an open
+// interrupted by a signal.
+const openEINTRRetries = 5
 
-	go func() {
-		select {
-		case <-ctx.Done():
-			f.cond.Broadcast()
-		case <-done:
-		}
-	}()
+// fdExhaustedRetries is how many times an open is retried when the
+// process or system is out of file descriptors, waiting up to
+// fdExhaustedBackoff, doubling each time, for a file to be closed.
+const (
+	fdExhaustedRetries = 3
+	fdExhaustedBackoff = 10 * time.Millisecond
+)
 
+// waitClose waits until a file in the Filer is closed, or for d.
+func (f *Filer) waitClose(d time.Duration) {
 	f.mu.Lock()
-	for {
-		select {
-		case <-ctx.Done():
-			for file := range f.files {
-				if f.Logf != nil {
-					f.Logf("iox.Filer.Shutdown: closing file created by %s: %s", file.creator(), file.File.Name())
-				}
-				file.File.Close()
-				delete(f.files, file)
-			}
-			// now len(f.files) == 0
-		default:
-			if f.Logf != nil {
-				for file := range f.files {
-					f.Logf("iox.Filer.Shutdown: waiting for file created by %s: %s", file.creator(), file.File.Name())
-				}
-			}
-		}
-		if len(f.files) == 0 {
+	t := time.AfterFunc(d, func() {
+		f.mu.Lock()
+		f.cond.Broadcast()
+		f.mu.Unlock()
+	})
+	f.cond.Wait()
+	f.mu.Unlock()
+	t.Stop()
+}
+
+// openRetry is fs.OpenFile, retrying opens that fail with EINTR.
+// The os package retries most interrupted system calls, but an open
+// interrupted by a signal, for example from a profiler, can still
+// report EINTR. The caller holds a single slot for all the attempts.
+func openRetry(fs fileSystem, name string, flag int, perm os.FileMode) (osfile *os.File, err error) {
+	for i := 0; i < openEINTRRetries; i++ {
+		osfile, err = fs.OpenFile(name, flag, perm)
+		if !errors.Is(err, syscall.EINTR) {
 			break
 		}
-		f.cond.Wait()
 	}
-	f.mu.Unlock()
-
-	close(done)
-	return ctx.Err()
+	return osfile, err
 }
 
-func (f *Filer) newFile() *File {
-	file := &File{filer: f}
+// setOpening records whether file is in the open system call,
+// which may block, as for a FIFO.
+func (file *fileState) setOpening(opening bool) {
+	file.filer.mu.Lock()
+	file.opening = opening
+	file.filer.mu.Unlock()
+}
 
+// setOpened records that file has been opened as osfile, by name.
+//
+// If Shutdown has closed the Filer's files while the open was in
+// progress, it reports ErrFilerClosed and the caller must close osfile.
+func (file *File) setOpened(osfile *os.File, name string) error {
+	f := file.filer
 	f.mu.Lock()
-	for {
-		select {
-		case <-f.shuttingDown:
-			f.mu.Unlock()
-			return nil
-		default:
-		}
-		if len(f.files) < f.fdlimit {
-			break
-		}
-		f.cond.Wait()
+	if f.forced {
+		f.mu.Unlock()
+		return ErrFilerClosed
 	}
-	f.files[file] = struct{}{}
+	file.osfile = osfile // read by Shutdown
+	file.fileName = name
+	file.openedAt = time.Now()
 	f.mu.Unlock()
+	file.File = osfile
+	file.touch()
+	if f.WarnLeaks {
+		runtime.SetFinalizer(file, (*File).leaked)
+	}
+	if f.OnOpen != nil {
+		f.OnOpen(file.fileName)
+	}
+	return nil
+}
 
-	return file
+// Adopt makes the Filer manage osf, an *os.File opened elsewhere,
+// such as a descriptor passed in by another process.
+//
+// Adopt waits for a file descriptor slot like an open, so an adopted
+// file counts against the Filer's limit. Closing the returned File
+// closes osf and releases the slot. Adopted files cannot be reopened.
+func (f *Filer) Adopt(osf *os.File) (*File, error) {
+	if osf == nil {
+		return nil, os.ErrInvalid
+	}
+	file, err := f.newFile(context.Background(), openOptions{origin: OriginAdopted})
+	if err != nil {
+		return nil, err
+	}
+	file.setCreator(callers(f))
+	if err := file.setOpened(osf, osf.Name()); err != nil {
+		file.remove()
+		return nil, err
+	}
+	return file, nil
 }
 
-func (f *Filer) rand() string {
-	const mod = 0x7fffffff
+// Reopen reopens a File that has been closed, by Close, for being
+// idle, or by Shutdown. It waits for a file descriptor like a new
+// open and opens the same name with the same flags and permissions,
+// except that O_TRUNC and O_EXCL are not used again.
+// Reopen of a File that is open does nothing.
+//
+// Temporary files are removed when closed and cannot be reopened.
+// Reopen must not be called concurrently with other methods of the File.
+func (file *File) Reopen() error {
+	if file == nil || file.File == nil || file.openName == "" {
+		return os.ErrInvalid
+	}
+	file.useMu.Lock()
+	defer file.useMu.Unlock()
+	if atomic.LoadInt32(&file.fdClosed) == 0 {
+		return nil
+	}
+	if file.isTemp {
+		return &os.PathError{Op: "reopen", Path: file.openName, Err: errors.New("temporary file removed on close")}
+	}
 
-	f.mu.Lock()
-	for f.seed == 0 {
-		f.seed = uint32((time.Now().UnixNano() + int64(os.Getpid())) % mod)
+	f := file.filer
+	if err := f.acquire(context.Background(), file.fileState, openOptions{}); err != nil {
+		return err
+	}
+	file.setOpening(true)
+	osfile, err := openRetry(f.fs, file.openName, file.openFlag&^(os.O_TRUNC|os.O_EXCL), file.openPerm)
+	file.setOpening(false)
+	if err == nil && f.InheritFDs {
+		if err = setInherit(osfile); err != nil {
+			osfile.Close()
+		}
+	}
+	if err != nil {
+		file.remove()
+		return err
 	}
-	// Park-Miller RNG, constants from wikipedia.
-	v := uint32(uint64(f.seed) * 48271 % mod)
-	f.seed = v
+	atomic.StoreInt32(&file.closed, 0)
+	f.mu.Lock()
+	file.idleClosed = false
 	f.mu.Unlock()
+	atomic.StoreInt32(&file.fdClosed, 0)
+	atomic.StoreInt32(&file.locked, 0)
+	file.invalidateStat()
+	if err := file.setOpened(osfile, file.openName); err != nil {
+		osfile.Close()
+		file.remove()
+		return err
+	}
+	return nil
+}
 
-	return strconv.FormatUint(uint64(v), 16)
+func (f *Filer) TempFile(dir, prefix, suffix string) (file *File, err error) {
+	file, err = f.tempFile(context.Background(), dir, prefix, suffix, 0600)
+	if file != nil {
+		file.setCreator(callers(f))
+	}
+	return file, err
 }
 
-// File is an *os.File managed by a Filer.
+// TempFileContext is TempFile with a context.
 //
-// The Close method must be called on a File.
-type File struct {
-	*os.File
+// If the Filer has exhausted its file descriptors, TempFileContext
+// blocks until one is available or ctx is done, as OpenContext.
+func (f *Filer) TempFileContext(ctx context.Context, dir, prefix, suffix string) (*File, error) {
+	file, err := f.tempFile(ctx, dir, prefix, suffix, 0600)
+	if file != nil {
+		file.setCreator(callers(f))
+	}
+	return file, err
+}
 
-	filer  *Filer
-	isTemp bool
+// TempFilePerm is TempFile with the permission bits perm (before umask)
+// instead of 0600.
+//
+// Like TempFile, the file is created with O_EXCL, so an existing
+// file is never opened.
+func (f *Filer) TempFilePerm(dir, prefix, suffix string, perm os.FileMode) (*File, error) {
+	file, err := f.tempFile(context.Background(), dir, prefix, suffix, perm)
+	if file != nil {
+		file.setCreator(callers(f))
+	}
+	return file, err
+}
 
-	// runtime.Callers where the File was created
-	pc  [3]uintptr
-	pcN int
+// TempFileSize is TempFile that reserves size bytes of disk space for
+// the file, so a full disk is reported up front.
+//
+// Where the platform supports it (fallocate on Linux), the space is
+// allocated. Elsewhere the file is extended with Truncate, which may
+// not reserve disk blocks.
+func (f *Filer) TempFileSize(dir, prefix, suffix string, size int64) (*File, error) {
+	file, err := f.tempFile(context.Background(), dir, prefix, suffix, 0600)
+	if err != nil {
+		return nil, err
+	}
+	file.setCreator(callers(f))
+	if err := allocate(file.File, size); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
 }
 
-func (file *File) remove() {
-	file.filer.mu.Lock()
-	delete(file.filer.files, file)
-	file.filer.cond.Signal()
-	file.filer.mu.Unlock()
+// CreateTemp is TempFile with a pattern in the style of os.CreateTemp.
+//
+// The random string replaces the last "*" in pattern, or is appended
+// to pattern if it has no "*".
+func (f *Filer) CreateTemp(dir, pattern string) (*File, error) {
+	if strings.ContainsRune(pattern, os.PathSeparator) {
+		return nil, &os.PathError{Op: "createtemp", Path: pattern, Err: errors.New("pattern contains path separator")}
+	}
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	file, err := f.tempFile(context.Background(), dir, prefix, suffix, 0600)
+	if file != nil {
+		file.setCreator(callers(f))
+	}
+	return file, err
 }
 
-// Close closes the underlying file descriptor and informs the Filer.
-func (file *File) Close() error {
-	if file == nil || file.File == nil {
-		return os.ErrInvalid
+// tempFile creates a temporary file, removed when closed.
+func (f *Filer) tempFile(ctx context.Context, dir, prefix, suffix string, perm os.FileMode) (file *File, err error) {
+	if f.Tracer != nil {
+		var end func(error)
+		ctx, end = f.Tracer.StartSpan(ctx, "iox.Filer.TempFile")
+		defer func() { end(err) }()
 	}
-	err := file.File.Close()
-	file.remove()
+	if dir == "" {
+		dir = f.tempdir
+	}
+	if f.jail != "" {
+		if dir, err = f.jailTemp(dir, prefix, suffix); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.checkTempdir(dir); err != nil {
+		return nil, err
+	}
+	if err := f.acquireTemp(ctx); err != nil {
+		return nil, err
+	}
+	file, err = f.createTemp(ctx, dir, prefix, suffix, perm)
+	if err != nil {
+		f.mu.Lock()
+		f.releaseTempLocked()
+		f.mu.Unlock()
+	}
+	if file != nil {
+		f.mu.Lock()
+		file.isTemp = true // read by Stats
+		if f.ManualTempCleanup {
+			if f.tempNames == nil {
+				f.tempNames = make(map[string]struct{})
+			}
+			f.tempNames[file.fileName] = struct{}{}
+		}
+		f.mu.Unlock()
+	}
+	return file, err
+}
 
-	if file.isTemp {
-		rmErr := os.Remove(file.File.Name())
-		if err == nil {
-			err = rmErr
+// acquireTemp counts a new temporary file, first waiting until
+// there are fewer than MaxTempFiles.
+func (f *Filer) acquireTemp(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.MaxTempFiles > 0 && f.tempCount >= f.MaxTempFiles && f.FailAtMaxTempFiles {
+		return ErrTooManyTempFiles
+	}
+	for f.MaxTempFiles > 0 && f.tempCount >= f.MaxTempFiles {
+		select {
+		case <-f.shuttingDown:
+			return ErrFilerClosed
+		default:
+		}
+		if err := ctx.Err(); err != nil {
+			return err
 		}
+		stop := context.AfterFunc(ctx, func() {
+			f.mu.Lock()
+			f.tempCond.Broadcast()
+			f.mu.Unlock()
+		})
+		f.tempCond.Wait()
+		stop()
 	}
-	return err
+	f.tempCount++
+	return nil
 }
 
-func (file *File) creator() string {
-	if file.pcN > 0 {
-		frames := runtime.CallersFrames(file.pc[:file.pcN])
-		if _, more := frames.Next(); more { // runtime.Callers
-			if _, more := frames.Next(); more { // filer.<exported function>
-				frame, _ := frames.Next() // caller we care about
-				if frame.Function != "" {
-					return frame.Function
-				}
-			}
+// releaseTempLocked uncounts a temporary file.
+// It must be called with f.mu held.
+func (f *Filer) releaseTempLocked() {
+	f.tempCount--
+	f.tempCond.Broadcast()
+}
+
+// createTemp creates a new file with a random name in dir.
+// The file is not marked as temporary, so Close does not remove it.
+//
+// If every name tried exists, it reports a *os.PathError for dir
+// whose Err is the last one's, so os.IsExist still matches.
+//
+// One slot is held for all the names tried, so the retries do not
+// contend for the Filer's lock.
+func (f *Filer) createTemp(ctx context.Context, dir, prefix, suffix string, perm os.FileMode) (*File, error) {
+	file, err := f.newFile(ctx, openOptions{origin: OriginTemp})
+	if err != nil {
+		return nil, err
+	}
+	retries := f.tempRetries()
+	for i := 0; i < retries; i++ {
+		if err = ctx.Err(); err != nil {
+			break
 		}
+		name := filepath.Join(dir, f.tempName(prefix, suffix))
+		err = file.open(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			break
+		}
+		return file, nil
+	}
+	file.remove()
+	if os.IsExist(err) {
+		err = exhaustedError("temp file", retries, dir, err)
+	}
+	return nil, err
+}
+
+// exhaustedError reports that retries attempts at creating a temp
+// file or directory in dir failed, the last with err.
+func exhaustedError(what string, retries int, dir string, err error) error {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	op := fmt.Sprintf("iox: exhausted %d attempts creating %s in", retries, what)
+	return &os.PathError{Op: op, Path: dir, Err: err}
+}
+
+// checkTempdir reports a clear error if dir is not a writable
+// directory, rather than leaving it to surface from each name tried.
+// If CreateTempdir is set, a missing dir is created.
+//
+// Errors are a *os.PathError for dir, so os.IsNotExist and
+// os.IsPermission match them.
+func (f *Filer) checkTempdir(dir string) error {
+	fi, err := f.fs.Stat(dir)
+	if os.IsNotExist(err) && f.CreateTempdir {
+		if err := f.fs.MkdirAll(dir, 0700); err != nil {
+			return tempdirError("iox: create temp directory", dir, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return tempdirError("iox: stat temp directory", dir, err)
+	}
+	if !fi.IsDir() {
+		return tempdirError("iox: temp directory", dir, syscall.ENOTDIR)
+	}
+	if err := f.fs.Writable(dir); err != nil {
+		return tempdirError("iox: temp directory not writable", dir, err)
+	}
+	return nil
+}
+
+// tempdirError reports err as a *os.PathError for the temp
+// directory dir, replacing the Op and Path of any it wraps.
+func tempdirError(op, dir string, err error) error {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return &os.PathError{Op: op, Path: dir, Err: err}
+}
+
+// tempName returns a candidate name for a temporary file.
+func (f *Filer) tempName(prefix, suffix string) string {
+	if f.TempNameFunc != nil {
+		return f.TempNameFunc(prefix, suffix)
+	}
+	return prefix + f.rand() + suffix
+}
+
+func (f *Filer) tempRetries() int {
+	if f.TempRetries <= 0 {
+		return 1000
+	}
+	return f.TempRetries
+}
+
+// TempDir creates a new temporary directory in the Filer's tempdir.
+//
+// The directory name begins with prefix and is followed by a random string.
+// The returned cleanup function removes the directory and its contents.
+// Directories do not count against the Filer's file descriptor limit.
+func (f *Filer) TempDir(prefix string) (dir string, cleanup func() error, err error) {
+	tempdir := f.tempdir
+	if f.jail != "" {
+		if tempdir, err = f.jailTemp(tempdir, prefix, ""); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := f.checkTempdir(tempdir); err != nil {
+		return "", nil, err
+	}
+	retries := f.tempRetries()
+	for i := 0; i < retries; i++ {
+		dir = filepath.Join(tempdir, prefix+f.rand())
+		err = f.fs.Mkdir(dir, 0700)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		cleanup = func() error { return f.fs.RemoveAll(dir) }
+		return dir, cleanup, nil
+	}
+	return "", nil, exhaustedError("temp directory", retries, tempdir, err)
+}
+
+// CleanStaleTemp removes files left in the Filer's tempdir by previous
+// runs of the program, for example after a crash.
+//
+// Regular files whose names begin with prefix and which were last
+// modified more than olderThan ago are removed. Files open in this
+// Filer are never removed.
+//
+// The tempdir is usually shared with other programs and other running
+// instances of this one, so prefix must name temporary files used only
+// by this program instance (for example, by including a per-instance
+// identifier in the prefix passed to TempFile), and olderThan should be
+// longer than any temporary file is expected to live.
+// An empty prefix is rejected.
+func (f *Filer) CleanStaleTemp(prefix string, olderThan time.Duration) (removed int, err error) {
+	if prefix == "" {
+		return 0, errors.New("iox: CleanStaleTemp requires a prefix")
+	}
+	if f.jail != "" {
+		if _, err := f.jailPath("cleanstaletemp", f.tempdir); err != nil {
+			return 0, err
+		}
+	}
+	infos, err := f.fs.ReadDir(f.tempdir)
+	if err != nil {
+		return 0, err
+	}
+
+	open := make(map[string]bool)
+	f.mu.Lock()
+	for file := range f.files {
+		if file.osfile != nil {
+			open[file.fileName] = true
+		}
+	}
+	f.mu.Unlock()
+
+	cutoff := time.Now().Add(-olderThan)
+	for _, fi := range infos {
+		if !fi.Mode().IsRegular() || !strings.HasPrefix(fi.Name(), prefix) || !fi.ModTime().Before(cutoff) {
+			continue
+		}
+		name := filepath.Join(f.tempdir, fi.Name())
+		if open[name] {
+			continue
+		}
+		if rmErr := f.fs.Remove(name); rmErr != nil {
+			if err == nil && !os.IsNotExist(rmErr) {
+				err = rmErr
+			}
+			continue
+		}
+		removed++
+	}
+	return removed, err
+}
+
+// Shutdown gracefully shuts down the Filer.
+// Any active files continue to work until the passed context is done.
+// At that point they are explicitly closed and further operations return errors.
+// Opens still in progress then fail with ErrFilerClosed when they
+// complete, closing the file they opened.
+// Shutdown returns the error from ctx, joined with any errors from
+// closing those files.
+func (f *Filer) Shutdown(ctx context.Context) error {
+	_, err := f.ShutdownWithReport(ctx)
+	return err
+}
+
+// ShutdownTimeout is Shutdown with a context that expires after d.
+//
+// It returns nil if all files were closed before the timeout.
+// Otherwise it returns an error wrapping context.DeadlineExceeded.
+func (f *Filer) ShutdownTimeout(d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	forced, err := f.ShutdownWithReport(ctx)
+	if len(forced) == 0 {
+		return nil
+	}
+	return fmt.Errorf("iox: Filer.Shutdown closed %d open files after %v: %w", len(forced), d, err)
+}
+
+// ShutdownWithReport is Shutdown that also reports the names of
+// files that were still open when ctx was done and had to be closed.
+//
+// Only the first call to any of the Shutdown methods shuts down
+// the Filer. Later and concurrent calls wait for it to finish, and
+// return its result; their own contexts are not used.
+func (f *Filer) ShutdownWithReport(ctx context.Context) (forced []string, err error) {
+	f.shutdownOnce.Do(func() {
+		f.shutdownForced, f.shutdownErr = f.shutdown(ctx)
+	})
+	return f.shutdownForced, f.shutdownErr
+}
+
+// shutdown shuts down the Filer, for ShutdownWithReport.
+func (f *Filer) shutdown(ctx context.Context) (forced []string, err error) {
+	close(f.shuttingDown)
+	f.cond.Broadcast()
+	f.mu.Lock()
+	f.tempCond.Broadcast()
+	f.mu.Unlock()
+	done := make(chan struct{})
+	var closeErrs []error
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.cond.Broadcast()
+		case <-done:
+		}
+	}()
+
+	// logs are run with f.mu released, so a Logger may use the Filer.
+	var logs []func()
+	runLogs := func() {
+		if len(logs) == 0 {
+			return
+		}
+		f.mu.Unlock()
+		for _, log := range logs {
+			log()
+		}
+		logs = logs[:0]
+		f.mu.Lock()
+	}
+
+	f.mu.Lock()
+	for {
+		select {
+		case <-ctx.Done():
+			if f.OnForceClose != nil {
+				var files []*File
+				for file := range f.files {
+					if file.osfile != nil {
+						files = append(files, &File{File: file.osfile, fileState: file})
+					}
+				}
+				f.mu.Unlock()
+				for _, file := range files {
+					f.OnForceClose(file)
+				}
+				f.mu.Lock()
+			}
+			f.forced = true
+			for file := range f.files {
+				if file.osfile == nil {
+					// Still opening: setOpened fails and the
+					// open closes its descriptor and slot.
+					continue
+				}
+				name, creator := file.name(), file.creator()
+				logs = append(logs, func() {
+					f.logFile(slog.LevelWarn, eventShutdownClose, "iox.Filer.Shutdown: closing file", name, creator,
+						"iox.Filer.Shutdown: closing file created by %s: %s", creator, name)
+				})
+				forced = append(forced, name)
+				if err := file.closeFD(file.osfile); err != nil {
+					closeErrs = append(closeErrs, err)
+				}
+				delete(f.files, file)
+			}
+			// now f.files holds only opens in progress
+			f.syncBudgetLocked()
+		default:
+			if f.Logger != nil || f.Logf != nil {
+				for file := range f.files {
+					name, creator := file.name(), file.creator()
+					logs = append(logs, func() {
+						f.logFile(slog.LevelInfo, eventShutdownWait, "iox.Filer.Shutdown: waiting for file", name, creator,
+							"iox.Filer.Shutdown: waiting for file created by %s: %s", creator, name)
+					})
+				}
+			}
+		}
+		runLogs()
+		if len(f.files) == 0 || f.forced {
+			break
+		}
+		f.cond.Wait()
+	}
+	f.mu.Unlock()
+
+	close(done)
+	err = ctx.Err()
+	if len(closeErrs) > 0 {
+		err = errors.Join(append([]error{err}, closeErrs...)...)
+	}
+	return forced, err
+}
+
+// A waiter is a goroutine blocked in newFile or Reserve.
+type waiter struct {
+	file     *fileState   // nil for Reserve
+	res      *Reservation // non-nil for Reserve
+	priority int
+	ready    chan struct{} // closed when file is given a slot
+}
+
+// newFile reserves a file descriptor slot for a new File.
+// It blocks until a slot is available, the Filer is shut down,
+// or ctx is done.
+// If opts.noWait is set and no slot is available, it returns ErrFilerBusy.
+func (f *Filer) newFile(ctx context.Context, opts openOptions) (*File, error) {
+	file := &File{fileState: &fileState{filer: f, origin: opts.origin}}
+	if err := f.acquire(ctx, file.fileState, opts); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// acquire reserves a file descriptor slot for file, as newFile.
+func (f *Filer) acquire(ctx context.Context, file *fileState, opts openOptions) error {
+	f.mu.Lock()
+	select {
+	case <-f.shuttingDown:
+		f.mu.Unlock()
+		return ErrFilerClosed
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		f.mu.Unlock()
+		return err
+	}
+	if opts.res != nil {
+		err := f.drawLocked(file, opts.res)
+		f.unlock()
+		return err
+	}
+	if !f.paused && len(f.waitq) == 0 && f.takeLocked(1) {
+		f.addLocked(file)
+		f.unlock()
+		return nil
+	}
+	if opts.noWait {
+		f.mu.Unlock()
+		return ErrFilerBusy
+	}
+	w := &waiter{
+		file:     file,
+		priority: opts.priority,
+		ready:    make(chan struct{}),
+	}
+	f.enqueueLocked(w)
+	f.mu.Unlock()
+
+	var err error
+	if f.Tracer != nil {
+		var end func(error)
+		_, end = f.Tracer.StartSpan(ctx, "iox.Filer.Wait")
+		defer func() { end(err) }()
+	}
+
+	var start time.Time
+	if f.OnWait != nil {
+		start = time.Now()
+	}
+	var timeout <-chan time.Time
+	if wait := f.openWait(); wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case <-w.ready:
+		if f.OnWait != nil {
+			f.OnWait(time.Since(start))
+		}
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+		if err == context.DeadlineExceeded {
+			err = ErrFilerTimeout
+		}
+	case <-timeout:
+		err = ErrFilerTimeout
+	case <-f.shuttingDown:
+		err = ErrFilerClosed
+	}
+
+	f.mu.Lock()
+	select {
+	case <-w.ready:
+		// Given a slot as we gave up, pass it on.
+		delete(f.files, w.file)
+	default:
+		f.dequeueLocked(w)
+	}
+	f.grantLocked() // w may have been blocking the head of the queue
+	f.unlock()
+	return err
+}
+
+// openWait reports how long an open may wait for a slot before
+// failing with ErrFilerTimeout, or 0 if there is no limit.
+// A shorter deadline of ctx ends the wait first through ctx.Done.
+func (f *Filer) openWait() time.Duration {
+	wait := f.MaxOpenWait
+	if d := f.DefaultOpenDeadline; d > 0 && (wait <= 0 || d < wait) {
+		wait = d
+	}
+	return wait
+}
+
+// enqueueLocked adds w to the wait queue, after any waiters
+// of the same or higher priority.
+// It must be called with f.mu held.
+func (f *Filer) enqueueLocked(w *waiter) {
+	i := len(f.waitq)
+	for i > 0 && f.waitq[i-1].priority < w.priority {
+		i--
+	}
+	f.waitq = append(f.waitq, nil)
+	copy(f.waitq[i+1:], f.waitq[i:])
+	f.waitq[i] = w
+}
+
+// dequeueLocked removes w from the wait queue.
+// It must be called with f.mu held.
+func (f *Filer) dequeueLocked(w *waiter) {
+	for i, w2 := range f.waitq {
+		if w2 == w {
+			f.waitq = append(f.waitq[:i], f.waitq[i+1:]...)
+			return
+		}
+	}
+}
+
+// usedLocked reports the number of slots in use by open files
+// and reservations.
+// It must be called with f.mu held.
+func (f *Filer) usedLocked() int {
+	return len(f.files) + f.reserved
+}
+
+// grantLocked gives free file descriptor slots to waiters.
+// It must be called with f.mu held.
+func (f *Filer) grantLocked() {
+	f.syncBudgetLocked()
+	for len(f.waitq) > 0 && !f.paused {
+		select {
+		case <-f.shuttingDown:
+			return
+		default:
+		}
+		w := f.waitq[0]
+		need := 1
+		if w.res != nil {
+			need = w.res.remaining
+		}
+		if !f.takeLocked(need) {
+			return
+		}
+		f.waitq[0] = nil
+		f.waitq = f.waitq[1:]
+		if w.res != nil {
+			f.reserved += need
+		} else {
+			f.addLocked(w.file)
+		}
+		close(w.ready)
+	}
+}
+
+// addLocked gives file a slot, recording the high-water mark.
+// It must be called with f.mu held.
+func (f *Filer) addLocked(file *fileState) {
+	f.files[file] = struct{}{}
+	if len(f.files) > f.peak {
+		f.peak = len(f.files)
+	}
+	f.highWaterLocked()
+}
+
+// Pause stops the Filer from opening files until Resume is called.
+//
+// Opens made while the Filer is paused wait, or for TryOpen and
+// TryOpenFile fail with ErrFilerBusy. Files already open are not
+// affected and may be closed. Unlike Shutdown, Pause can be undone.
+func (f *Filer) Pause() {
+	f.mu.Lock()
+	f.paused = true
+	f.mu.Unlock()
+}
+
+// Resume undoes Pause, letting waiting opens proceed in order.
+func (f *Filer) Resume() {
+	f.mu.Lock()
+	f.paused = false
+	f.grantLocked()
+	f.unlock()
+}
+
+// Stats is a snapshot of a Filer's file descriptor accounting.
+type Stats struct {
+	Open     int // files currently open, including those opening
+	Opening  int // files blocked in the open system call, such as a FIFO without a writer
+	Limit    int // maximum number of simultaneously open files
+	Waiters  int // goroutines blocked waiting for a file descriptor
+	TempOpen int // temporary files currently open
+	Peak     int // most files open at once since NewFiler or ResetPeak
+
+	ByOrigin [numOrigins]int // files currently open, indexed by FileOrigin
+}
+
+// Stats reports the current file descriptor usage of the Filer.
+func (f *Filer) Stats() Stats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := Stats{
+		Open:    len(f.files),
+		Limit:   f.fdlimit,
+		Waiters: len(f.waitq),
+		Peak:    f.peak,
+	}
+	for file := range f.files {
+		if file.isTemp {
+			s.TempOpen++
+		}
+		if file.opening {
+			s.Opening++
+		}
+		s.ByOrigin[file.origin]++
+	}
+	return s
+}
+
+// WaitBelow blocks until fewer than n files are open in the Filer,
+// or ctx is done, so callers can apply backpressure without
+// polling Stats.
+func (f *Filer) WaitBelow(ctx context.Context, n int) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.mu.Lock()
+			f.cond.Broadcast()
+			f.mu.Unlock()
+		case <-done:
+		}
+	}()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.files) >= n {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		f.cond.Wait()
+	}
+	return nil
+}
+
+// ResetPeak resets Stats.Peak to the number of files currently open.
+func (f *Filer) ResetPeak() {
+	f.mu.Lock()
+	f.peak = len(f.files)
+	f.mu.Unlock()
+}
+
+// OpenFileInfo describes a file open in a Filer.
+type OpenFileInfo struct {
+	Name     string
+	Creator  string // function that opened the file
+	IsTemp   bool
+	Origin   FileOrigin
+	OpenedAt time.Time
+}
+
+// OpenFiles reports the files currently open in the Filer.
+// Files still being opened are not included.
+func (f *Filer) OpenFiles() []OpenFileInfo {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	infos := make([]OpenFileInfo, 0, len(f.files))
+	for file := range f.files {
+		if file.osfile == nil {
+			continue
+		}
+		infos = append(infos, OpenFileInfo{
+			Name:     file.fileName,
+			Creator:  file.creator(),
+			IsTemp:   file.isTemp,
+			Origin:   file.origin,
+			OpenedAt: file.openedAt,
+		})
+	}
+	return infos
+}
+
+// RemoveAllTemp removes the temporary files left by Close when
+// ManualTempCleanup is set, and any still open. It reports the errors
+// from files that could not be removed, which it tries again on the
+// next call.
+func (f *Filer) RemoveAllTemp() error {
+	f.mu.Lock()
+	names := make([]string, 0, len(f.tempNames))
+	for name := range f.tempNames {
+		names = append(names, name)
+	}
+	f.mu.Unlock()
+
+	var errs []error
+	for _, name := range names {
+		if err := f.fs.Remove(name); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+			continue
+		}
+		f.mu.Lock()
+		delete(f.tempNames, name)
+		f.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// TempFiles reports the names of the temporary files currently open
+// in the Filer. They are removed when closed.
+func (f *Filer) TempFiles() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var names []string
+	for file := range f.files {
+		if file.isTemp && file.osfile != nil {
+			names = append(names, file.fileName)
+		}
+	}
+	return names
+}
+
+// syncAllWorkers bounds the number of concurrent Sync calls in SyncAll.
+const syncAllWorkers = 8
+
+// SyncAll commits the contents of every file open in the Filer to
+// stable storage. Files are synced concurrently, so the disk sees
+// several barriers at once rather than one after another.
+//
+// The set of files is fixed when SyncAll is called, files opened
+// during the sync may not be synced. Files closed during the sync
+// are skipped. All errors are reported, joined with errors.Join.
+// If ctx is done, no further files are synced and ctx.Err is
+// included in the result.
+func (f *Filer) SyncAll(ctx context.Context) error {
+	f.mu.Lock()
+	files := make([]*fileState, 0, len(f.files))
+	for file := range f.files {
+		files = append(files, file)
+	}
+	f.mu.Unlock()
+
+	workers := syncAllWorkers
+	if len(files) < workers {
+		workers = len(files)
+	}
+
+	var (
+		wg    sync.WaitGroup
+		errMu sync.Mutex
+		errs  []error
+		work  = make(chan *fileState)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range work {
+				if err := file.sync(); err != nil {
+					errMu.Lock()
+					errs = append(errs, err)
+					errMu.Unlock()
+				}
+			}
+		}()
+	}
+
+	var ctxErr error
+feed:
+	for _, file := range files {
+		if ctxErr = ctx.Err(); ctxErr != nil {
+			break
+		}
+		select {
+		case work <- file:
+		case <-ctx.Done():
+			ctxErr = ctx.Err()
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if ctxErr != nil {
+		errs = append(errs, ctxErr)
+	}
+	return errors.Join(errs...)
+}
+
+// rand returns a random string for naming temporary files.
+func (f *Filer) rand() string {
+	if f.randFunc != nil {
+		return f.randFunc()
+	}
+	var b [8]byte
+	if _, err := cryptorand.Read(b[:]); err == nil {
+		return hex.EncodeToString(b[:])
+	}
+	return f.seedRand()
+}
+
+// seedRand is a fallback for rand used if crypto/rand fails.
+func (f *Filer) seedRand() string {
+	const mod = 0x7fffffff
+
+	for {
+		old := atomic.LoadUint32(&f.seed)
+		seed := old
+		for seed == 0 {
+			seed = uint32((time.Now().UnixNano() + int64(os.Getpid())) % mod)
+		}
+		// Park-Miller RNG, constants from wikipedia.
+		v := uint32(uint64(seed) * 48271 % mod)
+		if atomic.CompareAndSwapUint32(&f.seed, old, v) {
+			return strconv.FormatUint(uint64(v), 16)
+		}
+	}
+}
+
+// File is an *os.File managed by a Filer.
+//
+// The Close method must be called on a File.
+type File struct {
+	*os.File
+	*fileState
+}
+
+// fileState is the part of a File tracked by its Filer.
+// Its exported fields are promoted to File.
+//
+// It is kept separate from File so that the Filer does not keep
+// a File reachable, allowing a finalizer to find leaked Files.
+type fileState struct {
+	// The 64-bit fields accessed atomically must stay first, where
+	// they are 8-byte aligned on 32-bit platforms. See sync/atomic.
+	lastUse      int64 // UnixNano, accessed atomically
+	bytesRead    int64 // accessed atomically, see Counters
+	bytesWritten int64 // accessed atomically, see Counters
+
+	// SyncOnClose, if set, makes Close sync the file before closing
+	// it, so a file about to be renamed into place is durable.
+	// It has no effect on temporary files, which Close removes.
+	// Files with SyncOnClose set are never closed as idle.
+	// It may be set after the file is opened, but not while the
+	// file is being closed.
+	SyncOnClose bool
+
+	filer    *Filer
+	osfile   *os.File // nil until opened, guarded by filer.mu
+	fileName string   // name of osfile, set with it
+	opening  bool     // in the open system call, guarded by filer.mu
+	isTemp   bool
+	origin   FileOrigin
+	openedAt time.Time
+
+	// arguments to openFile, for Reopen
+	openName string
+	openFlag int
+	openPerm os.FileMode
+
+	// useMu is held for reading during I/O, and the idle sweeper
+	// only closes a file if it can take it for writing, so an idle
+	// file is never closed mid-use. Close does not take it: closing
+	// the descriptor is what interrupts I/O blocked on it.
+	useMu      sync.RWMutex
+	idleClosed bool       // closed by sweepIdle, guarded by useMu and filer.mu
+	closed     int32      // Close was called, accessed atomically
+	locked     int32      // Lock or TryLock is held, accessed atomically
+	fdClosed   int32      // descriptor has been closed, accessed atomically
+	keep       int32      // MarkKeep was called, accessed atomically
+	mappings   []*mapping // made by Mmap, guarded by filer.mu
+
+	statMu  sync.Mutex
+	stat    os.FileInfo // cached by CachedStat, guarded by statMu
+	statGen int         // incremented by invalidateStat, guarded by statMu
+
+	onClose []func() // called by Close in reverse order
+
+	pc []uintptr // where the File was created, guarded by filer.mu
+}
+
+func (file *fileState) remove() {
+	file.filer.mu.Lock()
+	delete(file.filer.files, file)
+	if file.isTemp {
+		file.filer.releaseTempLocked()
+	}
+	file.filer.highWaterLocked()
+	file.filer.grantLocked()
+	file.filer.cond.Broadcast()
+	file.filer.unlock()
+}
+
+// closeFD closes the descriptor f of file, unless it has already
+// been closed. Close, Shutdown, and the idle sweeper all close
+// through closeFD so the descriptor is closed exactly once.
+func (file *fileState) closeFD(f *os.File) error {
+	if !atomic.CompareAndSwapInt32(&file.fdClosed, 0, 1) {
+		return &os.PathError{Op: "close", Path: f.Name(), Err: os.ErrClosed}
+	}
+	return f.Close()
+}
+
+// sync syncs the file unless it is closed or still opening.
+func (file *fileState) sync() error {
+	file.useMu.RLock()
+	defer file.useMu.RUnlock()
+	if atomic.LoadInt32(&file.closed) != 0 || file.idleClosed {
+		return nil
+	}
+	file.filer.mu.Lock()
+	osfile := file.osfile
+	file.filer.mu.Unlock()
+	if osfile == nil {
+		return nil
+	}
+	return osfile.Sync()
+}
+
+// name reports the name of the file, for logging.
+// It must be called with filer.mu held.
+func (file *fileState) name() string {
+	if file.osfile == nil {
+		return "<opening>"
+	}
+	return file.fileName
+}
+
+// Name returns the name of the file as presented to Open.
+// Unlike os.File.Name, it may be called after the File is closed.
+func (file *File) Name() string {
+	return file.fileName
+}
+
+// Close closes the underlying file descriptor and informs the Filer.
+// Closing a File more than once returns an *os.PathError wrapping
+// os.ErrClosed, as os.File does, and has no other effect.
+func (file *File) Close() error {
+	if file == nil || file.File == nil {
+		return os.ErrInvalid
+	}
+	runtime.SetFinalizer(file, nil)
+	if !atomic.CompareAndSwapInt32(&file.closed, 0, 1) {
+		return &os.PathError{Op: "close", Path: file.Name(), Err: os.ErrClosed}
+	}
+	// The idle sweeper skips closed files, so once closed is set
+	// idleClosed no longer changes.
+	file.filer.mu.Lock()
+	idleClosed := file.idleClosed
+	file.filer.mu.Unlock()
+	if idleClosed {
+		// The descriptor and slot were released by sweepIdle.
+		file.runOnClose()
+		return nil
+	}
+	if atomic.LoadInt32(&file.locked) != 0 {
+		unlockFile(file.File) // closing releases it anyway, but be explicit
+	}
+	tempSize := int64(-1)
+	if file.isTemp && file.filer.OnTempRemove != nil {
+		if fi, err := file.File.Stat(); err == nil {
+			tempSize = fi.Size()
+		}
+	}
+	var syncErr error
+	if file.SyncOnClose && !file.isTemp {
+		syncErr = syncFile(file.File)
+	}
+	err := file.closeFD(file.File)
+	if syncErr != nil {
+		err = syncErr
+	}
+	file.unmapAll()
+	file.runOnClose()
+	file.remove()
+
+	if file.isTemp {
+		f := file.filer
+		switch {
+		case f.KeepTempOnError && atomic.LoadInt32(&file.keep) != 0:
+			f.mu.Lock()
+			delete(f.tempNames, file.fileName)
+			f.mu.Unlock()
+			f.logFile(slog.LevelWarn, eventKeepTemp, "iox.File.Close: keeping temp file", file.Name(), "",
+				"iox.File.Close: keeping temp file %s", file.Name())
+		case f.ManualTempCleanup:
+			// Left for RemoveAllTemp.
+		default:
+			rmErr := f.fs.Remove(file.Name())
+			if rmErr == nil && f.OnTempRemove != nil {
+				f.OnTempRemove(file.Name(), tempSize, time.Since(file.openedAt))
+			}
+			if err == nil {
+				err = rmErr
+			}
+		}
+	}
+	if file.filer.OnClose != nil {
+		file.filer.OnClose(file.Name(), time.Since(file.openedAt))
+	}
+	return err
+}
+
+// MarkKeep marks a temporary file as failed, so that if the Filer's
+// KeepTempOnError is set, Close keeps the file for inspection.
+func (file *File) MarkKeep() {
+	atomic.StoreInt32(&file.keep, 1)
+}
+
+// syncFile syncs f, replaced by tests.
+var syncFile = (*os.File).Sync
+
+// SysFd returns the integer Unix file descriptor or Windows handle
+// of the file, for passing to cgo.
+//
+// Like os.File.Fd, it may put the descriptor into blocking mode, which
+// stops the Go runtime poller from servicing it. The descriptor is
+// only valid until the File is closed, so callers must keep the File
+// reachable (see runtime.KeepAlive) while using it.
+//
+// SysFd reports an error if the File has been closed.
+func (file *File) SysFd() (uintptr, error) {
+	file.useMu.RLock()
+	defer file.useMu.RUnlock()
+	if atomic.LoadInt32(&file.closed) != 0 || file.idleClosed {
+		return 0, os.ErrClosed
+	}
+	fd := file.File.Fd()
+	if fd == ^uintptr(0) {
+		return 0, os.ErrClosed // closed by Shutdown
+	}
+	return fd, nil
+}
+
+// OnClose registers fn to be called when the File is closed.
+//
+// Functions are called in the reverse order they were registered,
+// after the file descriptor is closed and before the Filer can reuse
+// its slot. A panic in fn is logged and does not stop other functions
+// from being called.
+func (file *File) OnClose(fn func()) {
+	file.onClose = append(file.onClose, fn)
+}
+
+func (file *File) runOnClose() {
+	for i := len(file.onClose) - 1; i >= 0; i-- {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					file.filer.logFile(slog.LevelError, eventOnClosePanic, "iox.File.Close: OnClose function panicked", file.Name(), "",
+						"iox.File.Close: OnClose function for %s panicked: %v", file.Name(), r)
+				}
+			}()
+			file.onClose[i]()
+		}()
+	}
+	file.onClose = nil
+}
+
+// leaked is the finalizer for a File when Filer.WarnLeaks is set.
+func (file *File) leaked() {
+	file.filer.mu.Lock()
+	creator := file.creator()
+	file.filer.mu.Unlock()
+	file.filer.logFile(slog.LevelWarn, eventLeak, "iox.Filer: file was never closed", file.Name(), creator,
+		"iox.Filer: file created by %s was never closed: %s", creator, file.Name())
+	file.Close()
+}
+
+// callers records the stack for setCreator.
+// It must be called directly by the exported method creating the file.
+func callers(f *Filer) []uintptr {
+	depth := f.CallerDepth
+	if depth <= 0 {
+		depth = 3
+	}
+	// Two more for callers and the Filer method, skipped by creator.
+	pc := make([]uintptr, depth+2)
+	return pc[:runtime.Callers(1, pc)]
+}
+
+// setCreator records where the file was created, for creator.
+func (file *fileState) setCreator(pc []uintptr) {
+	file.filer.mu.Lock()
+	file.pc = pc
+	file.filer.mu.Unlock()
+}
+
+// creator reports the functions that created the file,
+// innermost first.
+// It must be called with filer.mu held.
+func (file *fileState) creator() string {
+	frames := runtime.CallersFrames(file.pc)
+	var funcs []string
+	for i := 0; ; i++ {
+		frame, more := frames.Next()
+		// Skip callers and filer.<exported function>.
+		if i >= 2 && frame.Function != "" {
+			funcs = append(funcs, frame.Function)
+		}
+		if !more {
+			break
+		}
+	}
+	if len(funcs) == 0 {
+		return "<unknown>"
 	}
-	return "<unknown>"
+	return strings.Join(funcs, " <- ")
 }
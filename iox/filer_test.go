@@ -17,11 +17,20 @@ package iox
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -122,15 +131,15 @@ func TestFilerShutdownClean(t *testing.T) {
 	filer.Shutdown(context.Background())
 
 	f3err := <-f3ch
-	if f3err != context.Canceled {
-		t.Errorf("f3 create error: %v, want context Canceled", f3err)
+	if f3err != ErrFilerClosed {
+		t.Errorf("f3 create error: %v, want ErrFilerClosed", f3err)
 	}
 
-	if _, err := filer.OpenFile(filepath.Join(os.TempDir(), "never-created"), os.O_CREATE, 0600); err != context.Canceled {
-		t.Errorf("shutdown-then-OpenFile err=%v, want context.Canceled", err)
+	if _, err := filer.OpenFile(filepath.Join(os.TempDir(), "never-created"), os.O_CREATE, 0600); err != ErrFilerClosed {
+		t.Errorf("shutdown-then-OpenFile err=%v, want ErrFilerClosed", err)
 	}
-	if _, err := filer.Open(filepath.Join(os.TempDir(), "never-created")); err != context.Canceled {
-		t.Errorf("shutdown-then-Open err=%v, want context.Canceled", err)
+	if _, err := filer.Open(filepath.Join(os.TempDir(), "never-created")); err != ErrFilerClosed {
+		t.Errorf("shutdown-then-Open err=%v, want ErrFilerClosed", err)
 	}
 }
 
@@ -187,8 +196,8 @@ func TestFilerShutdownForced(t *testing.T) {
 	}()
 
 	time.Sleep(10 * time.Millisecond)
-	if _, err := filer.TempFile("", "canceled file", ""); err != context.Canceled {
-		t.Errorf("TempFile opened after Shutdown reports err %v, want context.Canceled", err)
+	if _, err := filer.TempFile("", "canceled file", ""); err != ErrFilerClosed {
+		t.Errorf("TempFile opened after Shutdown reports err %v, want ErrFilerClosed", err)
 	}
 
 	cancel()
@@ -234,3 +243,2130 @@ func TestFileNilClose(t *testing.T) {
 		t.Errorf("f.Close()=%v, want os.ErrInvalid", err)
 	}
 }
+
+func TestFilerOpenContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iox-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filer := NewFiler(1)
+	f1, err := filer.OpenFile(filepath.Join(dir, "f1"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = filer.OpenContext(ctx, f1.Name(), os.O_RDONLY, 0)
+	if err != ErrFilerTimeout {
+		t.Errorf("OpenContext on full Filer err=%v, want ErrFilerTimeout", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ErrFilerTimeout does not match context.DeadlineExceeded")
+	}
+	if _, err := filer.OpenContext(ctx, f1.Name(), os.O_RDONLY, 0); err != context.DeadlineExceeded {
+		t.Errorf("OpenContext with expired ctx err=%v, want context.DeadlineExceeded", err)
+	}
+
+	// A legitimate waiter must still get the slot after
+	// a canceled waiter gives up.
+	f2ch := make(chan error)
+	go func() {
+		f2, err := filer.OpenContext(context.Background(), f1.Name(), os.O_RDONLY, 0)
+		if f2 != nil {
+			f2.Close()
+		}
+		f2ch <- err
+	}()
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := filer.OpenContext(ctx, f1.Name(), os.O_RDONLY, 0); err != context.Canceled {
+		t.Errorf("canceled OpenContext err=%v, want context.Canceled", err)
+	}
+	if err := f1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-f2ch; err != nil {
+		t.Errorf("waiting OpenContext err=%v", err)
+	}
+}
+
+func TestFilerStats(t *testing.T) {
+	filer := NewFiler(2)
+	if got, want := filer.Stats(), (Stats{Limit: 2}); got != want {
+		t.Errorf("empty Stats()=%+v, want %+v", got, want)
+	}
+
+	f1, err := filer.TempFile("", "testfile1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := filer.Open(f1.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f3ch := make(chan error)
+	go func() {
+		f3, err := filer.Open(f1.Name())
+		if f3 != nil {
+			f3.Close()
+		}
+		f3ch <- err
+	}()
+	for filer.Stats().Waiters == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if got, want := filer.Stats(), (Stats{Open: 2, Limit: 2, Waiters: 1, TempOpen: 1, Peak: 2,
+		ByOrigin: [numOrigins]int{OriginOpenRead: 1, OriginTemp: 1}}); got != want {
+		t.Errorf("Stats()=%+v, want %+v", got, want)
+	}
+	if err := f2.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-f3ch; err != nil {
+		t.Fatal(err)
+	}
+	if err := f1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := filer.Stats(), (Stats{Limit: 2, Peak: 2}); got != want {
+		t.Errorf("final Stats()=%+v, want %+v", got, want)
+	}
+	filer.ResetPeak()
+	if got, want := filer.Stats(), (Stats{Limit: 2}); got != want {
+		t.Errorf("Stats() after ResetPeak=%+v, want %+v", got, want)
+	}
+}
+
+func TestFilerSetFDLimit(t *testing.T) {
+	filer := NewFiler(1)
+	f1, err := filer.TempFile("", "testfile1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f2ch := make(chan *File)
+	go func() {
+		f2, err := filer.TempFile("", "testfile2", "")
+		if err != nil {
+			t.Error(err)
+		}
+		f2ch <- f2
+	}()
+	for filer.Stats().Waiters == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	filer.SetFDLimit(0) // ignored
+	if got := filer.Stats().Limit; got != 1 {
+		t.Errorf("SetFDLimit(0) changed limit to %d", got)
+	}
+	filer.SetFDLimit(2)
+	f2 := <-f2ch
+	if f2 == nil {
+		t.Fatal("no f2")
+	}
+
+	// Lowering the limit does not close files, but blocks new opens.
+	filer.SetFDLimit(1)
+	if got := filer.Stats().Open; got != 2 {
+		t.Errorf("after lowering limit Open=%d, want 2", got)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := filer.OpenContext(ctx, f1.Name(), os.O_RDONLY, 0); err != ErrFilerTimeout {
+		t.Errorf("OpenContext over lowered limit err=%v, want ErrFilerTimeout", err)
+	}
+	f1.Close()
+	f2.Close()
+}
+
+func TestFilerTryOpen(t *testing.T) {
+	filer := NewFiler(1)
+	f1, err := filer.TempFile("", "testfile1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := filer.TryOpen(f1.Name()); err != ErrFilerBusy {
+		t.Errorf("TryOpen on full Filer err=%v, want ErrFilerBusy", err)
+	}
+	if _, err := filer.TryOpenFile(f1.Name(), os.O_RDWR, 0); err != ErrFilerBusy {
+		t.Errorf("TryOpenFile on full Filer err=%v, want ErrFilerBusy", err)
+	}
+	if got := filer.Stats().Open; got != 1 {
+		t.Errorf("failed TryOpen left Open=%d, want 1", got)
+	}
+	name := f1.Name()
+	f1dup, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f1dup.Close()
+	if err := f1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := filer.TryOpen(name); !os.IsNotExist(err) {
+		t.Errorf("TryOpen of removed temp file err=%v, want os.IsNotExist", err)
+	}
+	f2, err := filer.TryOpenFile(name, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(name)
+	if err := f2.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFilerOnOpenClose(t *testing.T) {
+	var opened, closed []string
+	var durations []time.Duration
+	filer := NewFiler(1)
+	filer.OnOpen = func(name string) {
+		opened = append(opened, name)
+		filer.Stats() // must not deadlock
+	}
+	filer.OnClose = func(name string, d time.Duration) {
+		closed = append(closed, name)
+		durations = append(durations, d)
+		filer.Stats()
+	}
+
+	f1, err := filer.TempFile("", "testfile1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := f1.Name()
+	time.Sleep(5 * time.Millisecond)
+	if err := f1.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(opened) != 1 || opened[0] != name {
+		t.Errorf("OnOpen calls: %q, want [%q]", opened, name)
+	}
+	if len(closed) != 1 || closed[0] != name {
+		t.Errorf("OnClose calls: %q, want [%q]", closed, name)
+	}
+	if len(durations) == 1 && durations[0] < 5*time.Millisecond {
+		t.Errorf("OnClose duration %v, want at least 5ms", durations[0])
+	}
+}
+
+func TestNewFilerDefault(t *testing.T) {
+	filer := NewFiler(0)
+	if limit := filer.Stats().Limit; limit <= 0 {
+		t.Errorf("NewFiler(0) limit=%d, want positive", limit)
+	}
+	f, err := filer.TempFile("", "testfile1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFilerRand(t *testing.T) {
+	const goroutines, calls = 8, 500
+
+	seen := make(map[string]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, filer := range []*Filer{NewFiler(1), NewFiler(1)} {
+		for i := 0; i < goroutines; i++ {
+			wg.Add(1)
+			go func(filer *Filer) {
+				defer wg.Done()
+				for j := 0; j < calls; j++ {
+					name := filer.rand()
+					mu.Lock()
+					if seen[name] {
+						t.Errorf("duplicate temp name component %q", name)
+					}
+					seen[name] = true
+					mu.Unlock()
+				}
+			}(filer)
+		}
+	}
+	wg.Wait()
+
+	hexRE := regexp.MustCompile(`^[0-9a-f]+$`)
+	for name := range seen {
+		if !hexRE.MatchString(name) {
+			t.Errorf("temp name component %q is not lowercase hex", name)
+		}
+	}
+}
+
+func leakATempFile(filer *Filer) error {
+	_, err := filer.TempFile("", "leaked-file", "")
+	return err
+}
+
+func TestFilerWarnLeaks(t *testing.T) {
+	var mu sync.Mutex
+	buf := new(bytes.Buffer)
+	filer := NewFiler(1)
+	filer.WarnLeaks = true
+	filer.Logf = func(format string, v ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(buf, format, v...)
+		buf.WriteByte('\n')
+	}
+
+	f, err := filer.TempFile("", "closed-file", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := leakATempFile(filer); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100 && filer.Stats().Open > 0; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	if open := filer.Stats().Open; open != 0 {
+		t.Errorf("leaked file still holds a descriptor, Open=%d", open)
+	}
+
+	mu.Lock()
+	log := buf.String()
+	mu.Unlock()
+	if !regexp.MustCompile(`iox.leakATempFile[^\n]*never closed[^\n]*leaked-file`).MatchString(log) {
+		t.Errorf("log does not report leaked file:\n%s", log)
+	}
+	if strings.Contains(log, "closed-file") {
+		t.Errorf("log reports a closed file as leaked:\n%s", log)
+	}
+}
+
+func TestFilerTempDir(t *testing.T) {
+	filer := NewFiler(1)
+	dir, cleanup, err := filer.TempDir("testdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(filepath.Base(dir), "testdir") {
+		t.Errorf("temp dir %q does not include 'testdir' prefix", dir)
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.IsDir() {
+		t.Errorf("%q is not a directory", dir)
+	}
+	if runtime.GOOS != "windows" {
+		if perm := fi.Mode().Perm(); perm != 0700 {
+			t.Errorf("temp dir mode %v, want 0700", perm)
+		}
+	}
+	if open := filer.Stats().Open; open != 0 {
+		t.Errorf("TempDir uses a file descriptor slot, Open=%d", open)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "f"), []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("temp dir %q exists after cleanup, err=%v", dir, err)
+	}
+}
+
+func TestFilerShutdownWithReport(t *testing.T) {
+	filer := NewFiler(2)
+	f1, err := filer.TempFile("", "testfile1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := filer.TempFile("", "testfile2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f2.Close(); err != nil {
+		t.Fatal(err)
+	}
+	defer f1.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	forced, err := filer.ShutdownWithReport(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("ShutdownWithReport err=%v, want context.DeadlineExceeded", err)
+	}
+	if len(forced) != 1 || forced[0] != f1.Name() {
+		t.Errorf("forced=%q, want [%q]", forced, f1.Name())
+	}
+}
+
+func TestFilerOnForceClose(t *testing.T) {
+	filer := NewFiler(3)
+	dir := t.TempDir()
+	var files []*File
+	for _, name := range []string{"a", "b", "closed"} {
+		f, err := filer.OpenFile(filepath.Join(dir, name), os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	if err := files[2].Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var flushed []string
+	filer.OnForceClose = func(file *File) {
+		if _, err := file.WriteString("flushed"); err != nil {
+			t.Errorf("OnForceClose write: %v", err)
+		}
+		flushed = append(flushed, filepath.Base(file.Name()))
+		if file.Name() == files[1].Name() {
+			file.Close() // closing in the callback is allowed
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	forced, err := filer.ShutdownWithReport(ctx)
+	if err != context.Canceled {
+		t.Errorf("ShutdownWithReport err=%v, want context.Canceled", err)
+	}
+	sort.Strings(flushed)
+	if want := []string{"a", "b"}; !reflect.DeepEqual(flushed, want) {
+		t.Errorf("OnForceClose called for %v, want %v", flushed, want)
+	}
+	if len(forced) != 1 || forced[0] != files[0].Name() {
+		t.Errorf("forced=%q, want [%q]", forced, files[0].Name())
+	}
+	for _, name := range []string{"a", "b"} {
+		if b, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || string(b) != "flushed" {
+			t.Errorf("%s contains %q, %v; want \"flushed\"", name, b, err)
+		}
+	}
+}
+
+func TestFilerShutdownCloseError(t *testing.T) {
+	filer := NewFiler(2)
+	f1, err := filer.TempFile("", "testfile1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f1.Name())
+	f2, err := filer.TempFile("", "testfile2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f2.Name())
+	f1.File.Close() // behind the Filer's back, so the forced close fails
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = filer.Shutdown(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Shutdown err=%v, want context.Canceled", err)
+	}
+	if !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Shutdown err=%v, want the close error of %s", err, f1.Name())
+	}
+}
+
+func TestFilerShutdownWithReportClean(t *testing.T) {
+	filer := NewFiler(1)
+	forced, err := filer.ShutdownWithReport(context.Background())
+	if err != nil || len(forced) != 0 {
+		t.Errorf("clean ShutdownWithReport forced=%q, err=%v", forced, err)
+	}
+}
+
+func TestFilerShutdownTimeout(t *testing.T) {
+	filer := NewFiler(1)
+	f1, err := filer.TempFile("", "testfile1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		f1.Close()
+	}()
+	if err := filer.ShutdownTimeout(time.Second); err != nil {
+		t.Errorf("clean ShutdownTimeout err=%v, want nil", err)
+	}
+
+	filer = NewFiler(1)
+	f1, err = filer.TempFile("", "testfile1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f1.Close()
+	err = filer.ShutdownTimeout(10 * time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("forced ShutdownTimeout err=%v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestFileOnClose(t *testing.T) {
+	var logged []string
+	filer := NewFiler(1)
+	filer.Logf = func(format string, v ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, v...))
+	}
+	f1, err := filer.TempFile("", "testfile1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []int
+	f1.OnClose(func() { calls = append(calls, 1) })
+	f1.OnClose(func() {
+		calls = append(calls, 2)
+		panic("boom")
+	})
+	f1.OnClose(func() {
+		calls = append(calls, 3)
+		if open := filer.Stats().Open; open != 1 {
+			t.Errorf("slot released before OnClose, Open=%d", open)
+		}
+	})
+	if err := f1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(calls) != "[3 2 1]" {
+		t.Errorf("OnClose calls %v, want [3 2 1]", calls)
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "boom") {
+		t.Errorf("panic not logged, log: %q", logged)
+	}
+}
+
+func TestFilerOpenFilePriority(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iox-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "f1")
+
+	filer := NewFiler(1)
+	f1, err := filer.OpenFile(name, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan string, 3)
+	open := func(id string, prio int) {
+		f, err := filer.OpenFilePriority(name, os.O_RDONLY, 0, prio)
+		order <- id
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		f.Close()
+	}
+	waitFor := func(n int) {
+		for filer.Stats().Waiters < n {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	go open("low1", 0)
+	waitFor(1)
+	go open("low2", 0)
+	waitFor(2)
+	go open("high", 1)
+	waitFor(3)
+
+	if err := f1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for i := 0; i < 3; i++ {
+		got = append(got, <-order)
+	}
+	if want := "[high low1 low2]"; fmt.Sprint(got) != want {
+		t.Errorf("acquisition order %v, want %s", got, want)
+	}
+}
+
+func TestFilerFairness(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping stress test in short mode")
+	}
+	const goroutines, opens = 200, 10
+
+	dir, err := ioutil.TempDir("", "iox-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "f")
+	if err := ioutil.WriteFile(name, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	filer := NewFiler(4)
+	waits := make(chan time.Duration, goroutines*opens)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < opens; j++ {
+				start := time.Now()
+				f, err := filer.Open(name)
+				waits <- time.Since(start)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				time.Sleep(100 * time.Microsecond)
+				f.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	close(waits)
+
+	var total, max time.Duration
+	var n int
+	for d := range waits {
+		total += d
+		n++
+		if d > max {
+			max = d
+		}
+	}
+	mean := total / time.Duration(n)
+	t.Logf("%d opens, mean wait %v, max wait %v", n, mean, max)
+	if max > 4*mean {
+		t.Errorf("max wait %v is more than 4x the mean wait %v", max, mean)
+	}
+}
+
+func TestFileSysFd(t *testing.T) {
+	filer := NewFiler(1)
+	f1, err := filer.TempFile("", "testfile1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := f1.SysFd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fd != f1.File.Fd() {
+		t.Errorf("SysFd()=%d, want %d", fd, f1.File.Fd())
+	}
+	if err := f1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f1.SysFd(); err != os.ErrClosed {
+		t.Errorf("SysFd after Close err=%v, want os.ErrClosed", err)
+	}
+}
+
+func TestFilerCreateTemp(t *testing.T) {
+	filer := NewFiler(1)
+	tests := []struct {
+		pattern, prefix, suffix string
+	}{
+		{"testfile-*.txt", "testfile-", ".txt"},
+		{"testfile-", "testfile-", ""},
+		{"a*b*.txt", "a*b", ".txt"},
+	}
+	for _, test := range tests {
+		f, err := filer.CreateTemp("", test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		base := filepath.Base(f.Name())
+		if !strings.HasPrefix(base, test.prefix) || !strings.HasSuffix(base, test.suffix) || len(base) == len(test.prefix)+len(test.suffix) {
+			t.Errorf("CreateTemp(%q) name %q, want %q + random + %q", test.pattern, base, test.prefix, test.suffix)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := filer.CreateTemp("", "a"+string(os.PathSeparator)+"*"); err == nil {
+		t.Error("CreateTemp with path separator in pattern succeeded")
+	}
+}
+
+func TestFilerTempFilePerm(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unix permission bits on windows")
+	}
+	filer := NewFiler(2)
+	for _, perm := range []os.FileMode{0644, 0600} {
+		var f *File
+		var err error
+		if perm == 0600 {
+			f, err = filer.TempFile("", "testfile", "")
+		} else {
+			f, err = filer.TempFilePerm("", "testfile", "", perm)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fi.Mode().Perm(); got != perm {
+			t.Errorf("temp file mode %v, want %v", got, perm)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFilerTempFileUnwritable(t *testing.T) {
+	filer := NewFiler(2)
+	notDir, err := filer.TempFile("", "not-a-dir", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notDir.Close()
+
+	start := time.Now()
+	if _, err := filer.TempFile(notDir.Name(), "testfile", ""); err == nil {
+		t.Error("TempFile in a regular file succeeded")
+	} else if strings.Contains(err.Error(), "exhausted") {
+		t.Errorf("TempFile in a regular file retried: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("TempFile took %v to fail", d)
+	}
+
+	if runtime.GOOS == "windows" || os.Getuid() == 0 {
+		return // read-only directories are writable
+	}
+	dir, err := ioutil.TempDir("", "iox-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(dir, 0500); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0700)
+	tries := 0
+	filer.TempNameFunc = func(prefix, suffix string) string {
+		tries++
+		return prefix + strconv.Itoa(tries) + suffix
+	}
+	if _, err := filer.TempFile(dir, "testfile", ""); !os.IsPermission(err) {
+		t.Errorf("TempFile in read-only dir err=%v, want os.IsPermission", err)
+	} else if !strings.Contains(err.Error(), "not writable") {
+		t.Errorf("TempFile in read-only dir err=%v, want not writable", err)
+	}
+	if tries != 0 {
+		t.Errorf("TempFile in read-only dir tried %d names", tries)
+	}
+	roFiler := NewFilerWithOptions(1, WithTempdir(dir))
+	if _, _, err := roFiler.TempDir("testdir"); !os.IsPermission(err) {
+		t.Errorf("TempDir in read-only dir err=%v, want os.IsPermission", err)
+	}
+}
+
+func TestFilerTempdirMissing(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "a", "b")
+	filer := NewFilerWithOptions(1, WithTempdir(missing))
+	tries := 0
+	filer.TempNameFunc = func(prefix, suffix string) string {
+		tries++
+		return prefix + strconv.Itoa(tries) + suffix
+	}
+
+	if _, err := filer.TempFile("", "testfile", ""); !os.IsNotExist(err) {
+		t.Errorf("TempFile in missing dir err=%v, want os.IsNotExist", err)
+	}
+	if tries != 0 {
+		t.Errorf("TempFile in missing dir tried %d names", tries)
+	}
+	if _, _, err := filer.TempDir("testdir"); !os.IsNotExist(err) {
+		t.Errorf("TempDir in missing dir err=%v, want os.IsNotExist", err)
+	}
+
+	filer.CreateTempdir = true
+	f, err := filer.TempFile("", "testfile", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(f.Name()) != missing {
+		t.Errorf("temp file %s not in %s", f.Name(), missing)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(missing); err != nil {
+		t.Fatal(err)
+	}
+	dir, cleanup, err := filer.TempDir("testdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if filepath.Dir(dir) != missing {
+		t.Errorf("temp dir %s not in %s", dir, missing)
+	}
+}
+
+func TestFilerCleanStaleTemp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iox-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filer := NewFiler(2)
+	filer.SetTempdir(dir)
+
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"stale-1", "stale-2", "other-1"} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "stale-dir"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := filer.TempFile("", "stale-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fresh.Close()
+	open, err := filer.OpenFile(filepath.Join(dir, "stale-2"), os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+
+	if _, err := filer.CleanStaleTemp("", time.Minute); err == nil {
+		t.Error("CleanStaleTemp with empty prefix succeeded")
+	}
+	removed, err := filer.CleanStaleTemp("stale-", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("removed %d files, want 1", removed)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+	if len(names) != 4 {
+		t.Errorf("remaining files: %q, want other-1, stale-2, stale-dir, and the fresh temp file", names)
+	}
+}
+
+func TestFilerTempFileSize(t *testing.T) {
+	filer := NewFiler(1)
+	f, err := filer.TempFileSize("", "testfile", "", 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 4096 {
+		t.Errorf("Size()=%d, want 4096", fi.Size())
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := filer.TempFileSize("", "testfile", "", -1); err == nil {
+		t.Error("TempFileSize with negative size succeeded")
+	}
+	if open := filer.Stats().Open; open != 0 {
+		t.Errorf("failed TempFileSize left Open=%d, want 0", open)
+	}
+}
+
+func TestFilerSyncAll(t *testing.T) {
+	filer := NewFiler(32)
+	var files []*File
+	for i := 0; i < 20; i++ {
+		f, err := filer.TempFile("", "iox-syncall-", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(f, "file %d", i)
+		files = append(files, f)
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	if err := filer.SyncAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Close two descriptors behind the Filer's back so their Sync fails.
+	files[3].File.Close()
+	files[7].File.Close()
+	err := filer.SyncAll(context.Background())
+	if !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("SyncAll err=%v, want os.ErrClosed", err)
+	}
+	if errs := err.(interface{ Unwrap() []error }).Unwrap(); len(errs) != 2 {
+		t.Errorf("SyncAll reported %d errors, want 2: %v", len(errs), err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := filer.SyncAll(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("SyncAll(canceled) err=%v, want context.Canceled", err)
+	}
+}
+
+func TestFilerClosedError(t *testing.T) {
+	filer := NewFiler(1)
+	f1, err := filer.TempFile("", "iox-closed-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A blocked open is woken by Shutdown with ErrFilerClosed,
+	// even though its own context is still live.
+	errCh := make(chan error)
+	go func() {
+		_, err := filer.OpenContext(context.Background(), f1.Name(), os.O_RDONLY, 0)
+		errCh <- err
+	}()
+	for filer.Stats().Waiters == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	shutdownCh := make(chan error)
+	go func() { shutdownCh <- filer.Shutdown(context.Background()) }()
+
+	if err := <-errCh; err != ErrFilerClosed {
+		t.Errorf("blocked open err=%v, want ErrFilerClosed", err)
+	}
+	if _, err := filer.TempFile("", "iox-closed-", ""); err != ErrFilerClosed {
+		t.Errorf("TempFile after Shutdown err=%v, want ErrFilerClosed", err)
+	}
+	if errors.Is(ErrFilerClosed, context.Canceled) {
+		t.Error("ErrFilerClosed matches context.Canceled")
+	}
+
+	f1.Close()
+	if err := <-shutdownCh; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+}
+
+func TestFilerShutdownCloseRace(t *testing.T) {
+	const n = 64
+	filer := NewFiler(n)
+	var files []*File
+	for i := 0; i < n; i++ {
+		f, err := filer.TempFile("", "iox-shutdown-race-", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+
+	const deadline = 5 * time.Millisecond
+	shutdownCh := make(chan error)
+	go func() { shutdownCh <- filer.ShutdownTimeout(deadline) }()
+
+	var wg sync.WaitGroup
+	for i, f := range files {
+		wg.Add(1)
+		go func(i int, f *File) {
+			defer wg.Done()
+			// Spread the closes on either side of the deadline.
+			time.Sleep(time.Duration(i) * 2 * deadline / n)
+			if err := f.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+				t.Errorf("Close: %v", err)
+			}
+		}(i, f)
+	}
+	wg.Wait()
+	<-shutdownCh
+
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("after Shutdown, Stats().Open=%d, want 0", got)
+	}
+	for _, f := range files {
+		if err := f.Close(); !errors.Is(err, os.ErrClosed) {
+			t.Errorf("second Close err=%v, want os.ErrClosed", err)
+		}
+	}
+}
+
+func TestNewFilerWithOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iox-options-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var logged bool
+	filer := NewFilerWithOptions(2,
+		WithTempdir(dir),
+		WithLogf(func(string, ...interface{}) { logged = true }),
+		WithBufferMemSize(8),
+	)
+	if filer.DefaultBufferMemSize != 8 {
+		t.Errorf("DefaultBufferMemSize=%d, want 8", filer.DefaultBufferMemSize)
+	}
+	f, err := filer.TempFile("", "iox-options-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Dir(f.Name()); got != dir {
+		t.Errorf("TempFile dir=%q, want %q", got, dir)
+	}
+	filer.ShutdownTimeout(0)
+	if !logged {
+		t.Error("Logf not called for file open at Shutdown")
+	}
+	f.Close()
+
+	if def := NewFiler(2); def.DefaultBufferMemSize != 1<<16 || def.tempdir != os.TempDir() {
+		t.Errorf("NewFiler defaults changed: %d, %q", def.DefaultBufferMemSize, def.tempdir)
+	}
+}
+
+func TestFilerOnWait(t *testing.T) {
+	filer := NewFiler(1)
+	waits := make(chan time.Duration, 2)
+	filer.OnWait = func(waited time.Duration) { waits <- waited }
+
+	dir, err := ioutil.TempDir("", "iox-onwait-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f1, err := filer.OpenFile(filepath.Join(dir, "f"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case d := <-waits:
+		t.Fatalf("OnWait(%v) called for open that did not wait", d)
+	default:
+	}
+
+	const hold = 20 * time.Millisecond
+	errCh := make(chan error)
+	go func() {
+		f2, err := filer.Open(f1.Name())
+		if f2 != nil {
+			f2.Close()
+		}
+		errCh <- err
+	}()
+	for filer.Stats().Waiters == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(hold)
+	f1.Close()
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case d := <-waits:
+		if d < hold {
+			t.Errorf("OnWait(%v), want at least %v", d, hold)
+		}
+	default:
+		t.Error("OnWait not called for open that waited")
+	}
+}
+
+func TestFilerOpenFiles(t *testing.T) {
+	filer := NewFiler(2)
+	if got := filer.OpenFiles(); len(got) != 0 {
+		t.Errorf("OpenFiles()=%v, want none", got)
+	}
+
+	before := time.Now()
+	f1, err := filer.TempFile("", "iox-openfiles-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f1.Close()
+	f2, err := filer.Open(f1.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infos := filer.OpenFiles()
+	if len(infos) != 2 {
+		t.Fatalf("OpenFiles() returned %d files, want 2", len(infos))
+	}
+	temps := 0
+	for _, info := range infos {
+		if info.Name != f1.Name() {
+			t.Errorf("Name=%q, want %q", info.Name, f1.Name())
+		}
+		if !strings.HasPrefix(info.Creator, "github.com/moleculer-go/sqlite/iox.TestFilerOpenFiles ") {
+			t.Errorf("Creator=%q, want TestFilerOpenFiles", info.Creator)
+		}
+		if info.OpenedAt.Before(before) || info.OpenedAt.After(time.Now()) {
+			t.Errorf("OpenedAt=%v, want after %v", info.OpenedAt, before)
+		}
+		if info.IsTemp {
+			temps++
+		}
+	}
+	if temps != 1 {
+		t.Errorf("%d temp files reported, want 1", temps)
+	}
+
+	f2.Close()
+	if got := len(filer.OpenFiles()); got != 1 {
+		t.Errorf("after Close, OpenFiles() returned %d files, want 1", got)
+	}
+}
+
+func openThroughHelper(filer *Filer, name string) (*File, error) {
+	return openThroughHelper2(filer, name)
+}
+func openThroughHelper2(filer *Filer, name string) (*File, error) { return filer.Open(name) }
+
+func TestFilerCallerDepth(t *testing.T) {
+	const pkg = "github.com/moleculer-go/sqlite/iox."
+	tests := []struct {
+		depth int
+		want  string
+	}{
+		{0, pkg + "openThroughHelper2 <- " + pkg + "openThroughHelper <- " + pkg + "TestFilerCallerDepth"},
+		{1, pkg + "openThroughHelper2"},
+		{2, pkg + "openThroughHelper2 <- " + pkg + "openThroughHelper"},
+	}
+	for _, test := range tests {
+		filer := NewFiler(2)
+		if test.depth != 0 {
+			filer.CallerDepth = test.depth
+		}
+		f1, err := filer.TempFile("", "iox-callerdepth-", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f2, err := openThroughHelper(filer, f1.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		f1.Close()
+
+		infos := filer.OpenFiles()
+		if len(infos) != 1 {
+			t.Fatalf("OpenFiles() returned %d files, want 1", len(infos))
+		}
+		if got := infos[0].Creator; got != test.want {
+			t.Errorf("CallerDepth=%d: Creator=%q, want %q", test.depth, got, test.want)
+		}
+		f2.Close()
+	}
+}
+
+func TestFilerMaxOpenWait(t *testing.T) {
+	filer := NewFiler(1)
+	filer.MaxOpenWait = 20 * time.Millisecond
+	f1, err := filer.TempFile("", "iox-maxopenwait-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := filer.Open(f1.Name()); err != ErrFilerTimeout {
+		t.Errorf("Open on full Filer err=%v, want ErrFilerTimeout", err)
+	}
+	if d := time.Since(start); d < filer.MaxOpenWait {
+		t.Errorf("Open gave up after %v, want at least %v", d, filer.MaxOpenWait)
+	}
+	if got := filer.Stats().Waiters; got != 0 {
+		t.Errorf("after timeout, Stats().Waiters=%d, want 0", got)
+	}
+
+	// A file closed within MaxOpenWait is handed over.
+	errCh := make(chan error)
+	go func() {
+		f2, err := filer.TempFile("", "iox-maxopenwait-", "")
+		if f2 != nil {
+			f2.Close()
+		}
+		errCh <- err
+	}()
+	for filer.Stats().Waiters == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	f1.Close()
+	if err := <-errCh; err != nil {
+		t.Errorf("open within MaxOpenWait: %v", err)
+	}
+}
+
+func TestFilerDefaultOpenDeadline(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(name, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	filer := NewFiler(1)
+	f1, err := filer.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f1.Close()
+
+	// With no default, a plain open waits until a slot is free.
+	errCh := make(chan error)
+	go func() {
+		f2, err := filer.Open(name)
+		if f2 != nil {
+			f2.Close()
+		}
+		errCh <- err
+	}()
+	for filer.Stats().Waiters == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case err := <-errCh:
+		t.Fatalf("Open with no DefaultOpenDeadline returned early: %v", err)
+	default:
+	}
+	f1.Close()
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	f1, err = filer.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f1.Close()
+
+	filer.DefaultOpenDeadline = 20 * time.Millisecond
+	start := time.Now()
+	if _, err := filer.Open(name); err != ErrFilerTimeout {
+		t.Errorf("Open past DefaultOpenDeadline err=%v, want ErrFilerTimeout", err)
+	}
+	if d := time.Since(start); d < filer.DefaultOpenDeadline {
+		t.Errorf("Open gave up after %v, want at least %v", d, filer.DefaultOpenDeadline)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := filer.OpenContext(ctx, name, os.O_RDONLY, 0); err != ErrFilerTimeout {
+		t.Errorf("OpenContext without a deadline err=%v, want ErrFilerTimeout", err)
+	}
+
+	// The shorter of a context deadline and the default applies.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	start = time.Now()
+	if _, err := filer.OpenContext(ctx, name, os.O_RDONLY, 0); err != ErrFilerTimeout {
+		t.Errorf("OpenContext past DefaultOpenDeadline err=%v, want ErrFilerTimeout", err)
+	}
+	if d := time.Since(start); d < filer.DefaultOpenDeadline || d > time.Minute {
+		t.Errorf("OpenContext with a later deadline gave up after %v, want %v", d, filer.DefaultOpenDeadline)
+	}
+	filer.DefaultOpenDeadline = time.Hour
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if _, err := filer.OpenContext(ctx, name, os.O_RDONLY, 0); err != ErrFilerTimeout {
+		t.Errorf("OpenContext past its deadline err=%v, want ErrFilerTimeout", err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond || d > time.Minute {
+		t.Errorf("OpenContext with an earlier deadline gave up after %v, want 20ms", d)
+	}
+
+	// The shorter of MaxOpenWait and the default applies.
+	filer.DefaultOpenDeadline = time.Hour
+	filer.MaxOpenWait = 10 * time.Millisecond
+	if _, err := filer.TempFile("", "iox-deadline-", ""); err != ErrFilerTimeout {
+		t.Errorf("TempFile past MaxOpenWait err=%v, want ErrFilerTimeout", err)
+	}
+}
+
+func TestFileDoubleClose(t *testing.T) {
+	filer := NewFiler(2)
+	var closes int
+	filer.OnClose = func(string, time.Duration) { closes++ }
+
+	f1, err := filer.TempFile("", "iox-doubleclose-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := filer.TempFile("", "iox-doubleclose-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+
+	if err := f1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f1.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("second Close err=%v, want os.ErrClosed", err)
+	}
+	if closes != 1 {
+		t.Errorf("OnClose called %d times, want 1", closes)
+	}
+	if got := filer.Stats().Open; got != 1 {
+		t.Errorf("after double Close, Stats().Open=%d, want 1", got)
+	}
+
+	// The freed slot is usable, and no phantom slot was created.
+	f3, err := filer.TryOpen(f2.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f3.Close()
+	if _, err := filer.TryOpen(f2.Name()); err != ErrFilerBusy {
+		t.Errorf("TryOpen over limit err=%v, want ErrFilerBusy", err)
+	}
+}
+
+func TestFilerTempFileContext(t *testing.T) {
+	filer := NewFiler(1)
+	f1, err := filer.TempFileContext(context.Background(), "", "iox-tempctx-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(filepath.Base(f1.Name()), "iox-tempctx-") {
+		t.Errorf("TempFileContext name %q lacks prefix", f1.Name())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := filer.TempFileContext(ctx, "", "iox-tempctx-", ""); err != ErrFilerTimeout {
+		t.Errorf("TempFileContext on full Filer err=%v, want ErrFilerTimeout", err)
+	}
+	if err := f1.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := filer.TempFileContext(ctx, "", "iox-tempctx-", ""); err != context.Canceled {
+		t.Errorf("TempFileContext with canceled ctx err=%v, want context.Canceled", err)
+	}
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("Stats().Open=%d, want 0", got)
+	}
+}
+
+func TestFilerTempFiles(t *testing.T) {
+	filer := NewFiler(3)
+	if names := filer.TempFiles(); len(names) != 0 {
+		t.Errorf("TempFiles()=%q, want none", names)
+	}
+	f1, err := filer.TempFile("", "iox-tempfiles-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := filer.Open(f1.Name()) // not temp
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+
+	names := filer.TempFiles()
+	if len(names) != 1 || names[0] != f1.Name() {
+		t.Errorf("TempFiles()=%q, want [%q]", names, f1.Name())
+	}
+	f1.Close()
+	if names := filer.TempFiles(); len(names) != 0 {
+		t.Errorf("after Close, TempFiles()=%q, want none", names)
+	}
+}
+
+func TestFilerPause(t *testing.T) {
+	filer := NewFiler(2)
+	f1, err := filer.TempFile("", "iox-pause-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f1.Close()
+
+	filer.Pause()
+	if _, err := filer.TryOpen(f1.Name()); err != ErrFilerBusy {
+		t.Errorf("TryOpen while paused err=%v, want ErrFilerBusy", err)
+	}
+	errCh := make(chan error)
+	go func() {
+		f2, err := filer.Open(f1.Name())
+		if f2 != nil {
+			f2.Close()
+		}
+		errCh <- err
+	}()
+	for filer.Stats().Waiters == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-errCh:
+		t.Fatalf("Open completed while paused: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	filer.Resume()
+	if err := <-errCh; err != nil {
+		t.Errorf("Open after Resume: %v", err)
+	}
+
+	// Pause is reversible, unlike Shutdown.
+	filer.Pause()
+	filer.Resume()
+	f3, err := filer.TryOpen(f1.Name())
+	if err != nil {
+		t.Fatalf("TryOpen after Resume: %v", err)
+	}
+	f3.Close()
+}
+
+func TestFilerAdopt(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	filer := NewFiler(1)
+	f, err := filer.Adopt(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filer.Stats().Open; got != 1 {
+		t.Errorf("Stats().Open=%d, want 1", got)
+	}
+	if infos := filer.OpenFiles(); len(infos) != 1 || !strings.HasPrefix(infos[0].Creator, "github.com/moleculer-go/sqlite/iox.TestFilerAdopt ") {
+		t.Errorf("OpenFiles()=%+v, want one file created by TestFilerAdopt", infos)
+	}
+	if _, err := filer.TryOpen(os.DevNull); err != ErrFilerBusy {
+		t.Errorf("TryOpen with adopted file holding the slot err=%v, want ErrFilerBusy", err)
+	}
+
+	if _, err := w.Write([]byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 2)
+	if _, err := io.ReadFull(f, b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hi" {
+		t.Errorf("read %q from adopted pipe, want %q", b, "hi")
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(b); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("read from adopted file after Close err=%v, want os.ErrClosed", err)
+	}
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("after Close, Stats().Open=%d, want 0", got)
+	}
+	if err := f.Reopen(); err != os.ErrInvalid {
+		t.Errorf("Reopen of adopted file err=%v, want os.ErrInvalid", err)
+	}
+}
+
+func TestSyncOnClose(t *testing.T) {
+	var synced []string
+	syncErr := errors.New("sync failed")
+	var failSync bool
+	syncFile = func(f *os.File) error {
+		synced = append(synced, filepath.Base(f.Name()))
+		if failSync {
+			return syncErr
+		}
+		return f.Sync()
+	}
+	defer func() { syncFile = (*os.File).Sync }()
+
+	filer := NewFiler(1)
+	dir := t.TempDir()
+	open := func(name string) *File {
+		t.Helper()
+		f, err := filer.OpenFile(filepath.Join(dir, name), os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	f := open("plain")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f = open("synced")
+	f.SyncOnClose = true
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tf, err := filer.TempFile(dir, "temp-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tf.SyncOnClose = true
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"synced"}; !reflect.DeepEqual(synced, want) {
+		t.Errorf("synced %v, want %v", synced, want)
+	}
+
+	failSync = true
+	f = open("failed")
+	f.SyncOnClose = true
+	if err := f.Close(); err != syncErr {
+		t.Errorf("Close: %v, want %v", err, syncErr)
+	}
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("%d files open after failed sync, want 0", got)
+	}
+}
+
+func TestTempNameFunc(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "job-7-0.tmp"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	filer := NewFiler(2)
+	var calls int
+	filer.TempNameFunc = func(prefix, suffix string) string {
+		name := fmt.Sprintf("%s%d-%d%s", prefix, 7, calls, suffix)
+		calls++
+		return name
+	}
+	f, err := filer.TempFile(dir, "job-", ".tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got, want := filepath.Base(f.Name()), "job-7-1.tmp"; got != want {
+		t.Errorf("temp file %q, want %q", got, want)
+	}
+	if calls != 2 {
+		t.Errorf("TempNameFunc called %d times, want 2", calls)
+	}
+
+	filer.TempRetries = 3
+	filer.TempNameFunc = func(prefix, suffix string) string { return "job-7-0.tmp" }
+	if _, err := filer.TempFile(dir, "job-", ".tmp"); !os.IsExist(errors.Unwrap(err)) {
+		t.Errorf("TempFile with only colliding names: %v, want an exists error", err)
+	}
+}
+
+func TestOpenEINTR(t *testing.T) {
+	var attempts int
+	var always bool
+	osOpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		attempts++
+		if attempts == 1 || always {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EINTR}
+		}
+		return os.OpenFile(name, flag, perm)
+	}
+	defer func() { osOpenFile = os.OpenFile }()
+
+	filer := NewFiler(1)
+	f, err := filer.TempFile("", "iox-eintr-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("%d open attempts, want 2", attempts)
+	}
+	if got := filer.Stats().Open; got != 1 {
+		t.Errorf("%d slots used after retried open, want 1", got)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	attempts, always = 0, true
+	if _, err := filer.TempFile("", "iox-eintr-", ""); !errors.Is(err, syscall.EINTR) {
+		t.Errorf("open always interrupted: %v, want EINTR", err)
+	}
+	if attempts != openEINTRRetries {
+		t.Errorf("%d open attempts, want %d", attempts, openEINTRRetries)
+	}
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("%d slots used after failed open, want 0", got)
+	}
+}
+
+func BenchmarkTempFileParallel(b *testing.B) {
+	filer := NewFilerWithOptions(64, WithTempdir(b.TempDir()))
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			f, err := filer.TempFile("", "bench-", "")
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			f.Close()
+		}
+	})
+}
+
+func TestFilerSeedRand(t *testing.T) {
+	const goroutines, calls = 8, 500
+
+	filer := NewFiler(1)
+	results := make([][]string, goroutines)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < calls; j++ {
+				results[i] = append(results[i], filer.seedRand())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for _, names := range results {
+		for _, name := range names {
+			if seen[name] {
+				t.Errorf("duplicate seedRand value %q", name)
+			}
+			seen[name] = true
+		}
+	}
+}
+
+func TestTempFileCollisions(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		rands    []string // returned by randFunc in turn
+		retries  int
+		want     string // base name created, or "" for an error
+	}{
+		{"no collision", nil, []string{"a"}, 3, "t-a"},
+		{"one collision", []string{"t-a"}, []string{"a", "b"}, 3, "t-b"},
+		{"repeated name", []string{"t-a"}, []string{"a", "a", "c"}, 3, "t-c"},
+		{"exhausted", []string{"t-a", "t-b"}, []string{"a", "b", "a"}, 3, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range test.existing {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			filer := NewFiler(1)
+			filer.TempRetries = test.retries
+			var calls int
+			filer.randFunc = func() string {
+				r := test.rands[calls]
+				calls++
+				return r
+			}
+
+			f, err := filer.TempFile(dir, "t-", "")
+			if test.want == "" {
+				if err == nil {
+					f.Close()
+					t.Fatalf("TempFile created %s, want error", f.Name())
+				}
+				if !os.IsExist(err) {
+					t.Errorf("TempFile: %v, want an exists error", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := filepath.Base(f.Name()); got != test.want {
+					t.Errorf("created %s, want %s", got, test.want)
+				}
+				f.Close()
+			}
+			if calls != len(test.rands) {
+				t.Errorf("%d names tried, want %d", calls, len(test.rands))
+			}
+			if got := filer.Stats().Open; got != 0 {
+				t.Errorf("%d slots held, want 0", got)
+			}
+		})
+	}
+}
+
+func TestFilerWaitBelow(t *testing.T) {
+	filer := NewFiler(4)
+	var files []*File
+	for i := 0; i < 4; i++ {
+		f, err := filer.TempFile("", "iox-waitbelow-", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+
+	if err := filer.WaitBelow(context.Background(), 5); err != nil {
+		t.Fatalf("WaitBelow above usage: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := filer.WaitBelow(ctx, 4); err != context.DeadlineExceeded {
+		t.Fatalf("WaitBelow at usage: %v, want context.DeadlineExceeded", err)
+	}
+
+	waited := make(chan error)
+	go func() { waited <- filer.WaitBelow(context.Background(), 2) }()
+	var wg sync.WaitGroup
+	for i, f := range files[:2] {
+		wg.Add(1)
+		go func(i int, f *File) {
+			defer wg.Done()
+			time.Sleep(time.Duration(i+1) * 5 * time.Millisecond)
+			f.Close()
+		}(i, f)
+	}
+	select {
+	case err := <-waited:
+		t.Fatalf("WaitBelow returned early: %v", err)
+	case <-time.After(2 * time.Millisecond):
+	}
+	files[2].Close() // 3 closed, 1 open
+	wg.Wait()
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitBelow did not return after usage dropped")
+	}
+	if got := filer.Stats().Open; got >= 2 {
+		t.Errorf("%d files open after WaitBelow(2)", got)
+	}
+	files[3].Close()
+}
+
+func TestFileName(t *testing.T) {
+	filer := NewFiler(1)
+	f, err := filer.TempFile("", "iox-name-", ".tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := f.Name()
+	if !strings.HasPrefix(filepath.Base(name), "iox-name-") || !strings.HasSuffix(name, ".tmp") {
+		t.Errorf("Name()=%q", name)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Name(); got != name {
+		t.Errorf("Name() after Close=%q, want %q", got, name)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("temp file %s not removed: %v", name, err)
+	}
+}
+
+func TestOpenEMFILE(t *testing.T) {
+	var attempts int
+	var always bool
+	osOpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		attempts++
+		if attempts == 1 || always {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EMFILE}
+		}
+		return os.OpenFile(name, flag, perm)
+	}
+	defer func() { osOpenFile = os.OpenFile }()
+
+	filer := NewFiler(2)
+	f, err := filer.TempFile("", "iox-emfile-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("%d open attempts, want 2", attempts)
+	}
+
+	// A close in the Filer wakes the waiting retry.
+	attempts = 0
+	go func() {
+		time.Sleep(time.Millisecond)
+		f.Close()
+	}()
+	f2, err := filer.TempFile("", "iox-emfile-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2.Close()
+	if attempts != 2 {
+		t.Errorf("%d open attempts, want 2", attempts)
+	}
+
+	attempts, always = 0, true
+	start := time.Now()
+	if _, err := filer.TempFile("", "iox-emfile-", ""); !errors.Is(err, syscall.EMFILE) {
+		t.Errorf("open always out of descriptors: %v, want EMFILE", err)
+	}
+	if attempts != 1+fdExhaustedRetries {
+		t.Errorf("%d open attempts, want %d", attempts, 1+fdExhaustedRetries)
+	}
+	if elapsed := time.Since(start); elapsed < fdExhaustedBackoff {
+		t.Errorf("gave up after %v, want at least %v of backoff", elapsed, fdExhaustedBackoff)
+	}
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("%d slots held, want 0", got)
+	}
+}
+
+func TestKeepTempOnError(t *testing.T) {
+	var logs []string
+	filer := NewFilerWithOptions(2, WithLogf(func(format string, v ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, v...))
+	}))
+	filer.KeepTempOnError = true
+
+	kept, err := filer.TempFile("", "iox-keep-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(kept.Name())
+	normal, err := filer.TempFile("", "iox-keep-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept.MarkKeep()
+	if err := kept.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := normal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(kept.Name()); err != nil {
+		t.Errorf("marked temp file not kept: %v", err)
+	}
+	if _, err := os.Stat(normal.Name()); !os.IsNotExist(err) {
+		t.Errorf("unmarked temp file not removed: %v", err)
+	}
+	if len(logs) != 1 || !strings.Contains(logs[0], kept.Name()) {
+		t.Errorf("logs=%q, want the kept file's name", logs)
+	}
+}
+
+func TestManualTempCleanup(t *testing.T) {
+	filer := NewFiler(3)
+	filer.ManualTempCleanup = true
+	filer.KeepTempOnError = true
+
+	var files []*File
+	for i := 0; i < 3; i++ {
+		f, err := filer.TempFile("", "iox-manual-", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+		files = append(files, f)
+	}
+	files[1].MarkKeep()
+	for _, f := range files[:2] {
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f.Name()); err != nil {
+			t.Errorf("temp file removed before RemoveAllTemp: %v", err)
+		}
+	}
+
+	if err := filer.RemoveAllTemp(); err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range files {
+		_, err := os.Stat(f.Name())
+		if kept := i == 1; kept && err != nil {
+			t.Errorf("kept temp file removed: %v", err)
+		} else if !kept && !os.IsNotExist(err) {
+			t.Errorf("temp file %d not removed by RemoveAllTemp: %v", i, err)
+		}
+	}
+	if err := files[2].Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := filer.RemoveAllTemp(); err != nil {
+		t.Errorf("second RemoveAllTemp: %v", err)
+	}
+}
+
+func TestFilerMaxTempFiles(t *testing.T) {
+	filer := NewFiler(10)
+	filer.MaxTempFiles = 2
+
+	var temps []*File
+	for i := 0; i < 2; i++ {
+		f, err := filer.TempFile("", "iox-maxtemp-", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		temps = append(temps, f)
+	}
+
+	// Other opens are not limited.
+	f, err := filer.Open(temps[0].Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	created := make(chan *File)
+	go func() {
+		f, err := filer.TempFile("", "iox-maxtemp-", "")
+		if err != nil {
+			t.Error(err)
+		}
+		created <- f
+	}()
+	select {
+	case <-created:
+		t.Fatal("third temp file created while two are open")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := filer.TempFileContext(ctx, "", "iox-maxtemp-", ""); err != context.DeadlineExceeded {
+		t.Errorf("TempFileContext at MaxTempFiles: %v, want context.DeadlineExceeded", err)
+	}
+
+	temps[0].Close()
+	select {
+	case f := <-created:
+		temps[0] = f
+	case <-time.After(5 * time.Second):
+		t.Fatal("third temp file not created after one was closed")
+	}
+
+	filer.FailAtMaxTempFiles = true
+	if _, err := filer.TempFile("", "iox-maxtemp-", ""); err != ErrTooManyTempFiles {
+		t.Errorf("TempFile with FailAtMaxTempFiles: %v, want ErrTooManyTempFiles", err)
+	}
+	for _, f := range temps {
+		if f != nil {
+			f.Close()
+		}
+	}
+	if filer.tempCount != 0 {
+		t.Errorf("tempCount=%d after closing all temp files, want 0", filer.tempCount)
+	}
+}
+
+func TestFilerDerive(t *testing.T) {
+	parent := NewFilerWithOptions(3, WithTempdir(t.TempDir()), WithBufferMemSize(1<<10))
+	parent.TempRetries = 7
+	child := parent.Derive(1)
+
+	if child.tempdir != parent.tempdir || child.DefaultBufferMemSize != 1<<10 || child.TempRetries != 7 {
+		t.Errorf("child configuration not copied: tempdir %q, DefaultBufferMemSize %d, TempRetries %d",
+			child.tempdir, child.DefaultBufferMemSize, child.TempRetries)
+	}
+
+	f1, err := child.TempFile("", "iox-derive-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f1.Close()
+	if filepath.Dir(f1.Name()) != parent.tempdir {
+		t.Errorf("child temp file %s not in parent tempdir %s", f1.Name(), parent.tempdir)
+	}
+	if _, err := child.TryOpen(f1.Name()); err != ErrFilerBusy {
+		t.Errorf("child TryOpen beyond its limit: %v, want ErrFilerBusy", err)
+	}
+
+	// The parent's slots are unaffected by the child's.
+	for i := 0; i < 3; i++ {
+		f, err := parent.TryOpen(f1.Name())
+		if err != nil {
+			t.Fatalf("parent open %d: %v", i, err)
+		}
+		defer f.Close()
+	}
+	if s := parent.Stats(); s.Open != 3 {
+		t.Errorf("parent has %d files open, want 3", s.Open)
+	}
+	if s := child.Stats(); s.Open != 1 || s.Limit != 1 {
+		t.Errorf("child Stats()=%+v, want 1 open of 1", s)
+	}
+}
+
+func TestFilerOnTempRemove(t *testing.T) {
+	filer := NewFiler(2)
+	type removal struct {
+		name     string
+		size     int64
+		lifetime time.Duration
+	}
+	var removed []removal
+	filer.OnTempRemove = func(name string, size int64, lifetime time.Duration) {
+		removed = append(removed, removal{name, size, lifetime})
+	}
+
+	f, err := filer.TempFile("", "iox-onremove-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(make([]byte, 1234)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 {
+		t.Fatalf("OnTempRemove called %d times, want 1", len(removed))
+	}
+	r := removed[0]
+	if r.name != name || r.size != 1234 {
+		t.Errorf("OnTempRemove(%q, %d), want (%q, 1234)", r.name, r.size, name)
+	}
+	if r.lifetime < 10*time.Millisecond || r.lifetime > time.Minute {
+		t.Errorf("OnTempRemove lifetime %v", r.lifetime)
+	}
+
+	// Regular files are not reported.
+	regular, err := filer.OpenFile(filepath.Join(t.TempDir(), "regular"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := regular.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 {
+		t.Errorf("OnTempRemove called %d times after closing a regular file, want 1", len(removed))
+	}
+}
+
+func TestFilerShutdownTwice(t *testing.T) {
+	filer := NewFiler(2)
+	f, err := filer.TempFile("", "iox-shutdown-twice-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = filer.Shutdown(ctx)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Shutdown %d: %v, want context.DeadlineExceeded", i, err)
+		}
+	}
+
+	// A later Shutdown returns the first one's result at once.
+	forced, err := filer.ShutdownWithReport(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) || len(forced) != 1 || forced[0] != f.Name() {
+		t.Errorf("third Shutdown=%v, %v, want [%s], context.DeadlineExceeded", forced, err, f.Name())
+	}
+}
+
+func TestFilerErrorsIs(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(name, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	filer := NewFiler(1)
+	filer.MaxFileSize = 10
+	f, err := filer.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, busyErr := filer.TryOpen(name)
+	_, canceledErr := filer.OpenContext(canceled, name, os.O_RDONLY, 0)
+	expired, cancel2 := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel2()
+	_, expiredErr := filer.OpenContext(expired, name, os.O_RDONLY, 0)
+	_, pastErr := filer.OpenContext(expired, name, os.O_RDONLY, 0)
+	_, tempCanceledErr := filer.TempFileContext(canceled, "", "iox-errors-", "")
+	tooLargeErr := f.Truncate(11)
+	f.Close()
+	alreadyClosedErr := f.Close()
+	filer.Shutdown(context.Background())
+	_, closedErr := filer.Open(name)
+
+	tests := []struct {
+		what   string
+		err    error
+		target []error
+	}{
+		{"TryOpen on a full Filer", busyErr, []error{ErrFilerBusy}},
+		{"OpenContext with a canceled ctx", canceledErr, []error{context.Canceled}},
+		{"OpenContext reaching its deadline", expiredErr, []error{ErrFilerTimeout, context.DeadlineExceeded}},
+		{"OpenContext past its deadline", pastErr, []error{context.DeadlineExceeded}},
+		{"TempFileContext with a canceled ctx", tempCanceledErr, []error{context.Canceled}},
+		{"Truncate above MaxFileSize", tooLargeErr, []error{ErrFileTooLarge}},
+		{"second Close", alreadyClosedErr, []error{os.ErrClosed}},
+		{"Open after Shutdown", closedErr, []error{ErrFilerClosed}},
+	}
+	all := []error{ErrFilerBusy, ErrFilerTimeout, ErrFileTooLarge, os.ErrClosed, ErrFilerClosed}
+	for _, test := range tests {
+		for _, target := range all {
+			want := false
+			for _, e := range test.target {
+				want = want || e == target
+			}
+			if got := errors.Is(test.err, target); got != want {
+				t.Errorf("%s: errors.Is(%v, %v)=%v, want %v", test.what, test.err, target, got, want)
+			}
+		}
+		for _, target := range test.target {
+			if !errors.Is(test.err, target) {
+				t.Errorf("%s: %v does not match %v", test.what, test.err, target)
+			}
+		}
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrTooLarge is returned by ReadFile when a file exceeds maxBytes.
+var ErrTooLarge = errors.New("iox: file too large")
+
+// ReadFile reads the named file and returns its contents.
+//
+// It is similar to ioutil.ReadFile except the file descriptor is managed
+// by the Filer, and if the file is larger than maxBytes it returns
+// ErrTooLarge without reading the whole file into memory.
+// If maxBytes is 0 (or less), the file size is not limited.
+func (f *Filer) ReadFile(name string, maxBytes int64) ([]byte, error) {
+	return f.readFile(context.Background(), name, maxBytes, callers(f))
+}
+
+// ReadFileContext is ReadFile that gives up with ctx.Err() when ctx
+// is done, as it waits for a file descriptor or between reads.
+func (f *Filer) ReadFileContext(ctx context.Context, name string, maxBytes int64) ([]byte, error) {
+	return f.readFile(ctx, name, maxBytes, callers(f))
+}
+
+func (f *Filer) readFile(ctx context.Context, name string, maxBytes int64, pc []uintptr) ([]byte, error) {
+	file, err := f.openFile(ctx, name, os.O_RDONLY, 0, openOptions{origin: OriginOpenRead})
+	if err != nil {
+		return nil, err
+	}
+	file.setCreator(pc)
+	defer file.Close()
+
+	var size int64
+	if fi, err := file.Stat(); err == nil {
+		size = fi.Size()
+	}
+	if maxBytes > 0 && size > maxBytes {
+		return nil, ErrTooLarge
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, size+bytes.MinRead))
+	var r io.Reader = file
+	if ctx.Done() != nil {
+		r = ctxReader{ctx, r, f.DefaultBufferMemSize}
+	}
+	if maxBytes > 0 {
+		r = io.LimitReader(r, maxBytes+1)
+	}
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	if maxBytes > 0 && int64(buf.Len()) > maxBytes {
+		return nil, ErrTooLarge
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteFileAtomic writes the named file so readers never see partial contents.
+//
+// The contents are written by write to a temporary file in the same
+// directory as name, so the final rename does not cross filesystems.
+// The temporary file is synced and renamed over name.
+// On any error the temporary file is removed and name is untouched.
+func (f *Filer) WriteFileAtomic(name string, perm os.FileMode, write func(w io.Writer) error) (err error) {
+	return f.writeFileAtomic(context.Background(), name, perm, write, callers(f))
+}
+
+// WriteFileAtomicContext is WriteFileAtomic that gives up with
+// ctx.Err() when ctx is done: writes to the io.Writer passed to write
+// fail, and the file is not renamed into place.
+func (f *Filer) WriteFileAtomicContext(ctx context.Context, name string, perm os.FileMode, write func(w io.Writer) error) error {
+	return f.writeFileAtomic(ctx, name, perm, write, callers(f))
+}
+
+func (f *Filer) writeFileAtomic(ctx context.Context, name string, perm os.FileMode, write func(w io.Writer) error, pc []uintptr) (err error) {
+	if f.jail != "" {
+		if name, err = f.jailEntry("open", name); err != nil {
+			return err
+		}
+	}
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+	file, err := f.createTemp(ctx, dir, "."+base+".", ".tmp", perm)
+	if err != nil {
+		return err
+	}
+	file.setCreator(pc)
+	tmpname := file.Name()
+
+	closed := false
+	defer func() {
+		if err != nil {
+			if !closed {
+				file.Close()
+			}
+			f.fs.Remove(tmpname)
+		}
+	}()
+
+	var w io.Writer = file
+	if ctx.Done() != nil {
+		w = ctxWriter{ctx, w}
+	}
+	if err := write(w); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	closed = true
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return f.Rename(tmpname, name)
+}
+
+// bufferedCopy copies src to dst through buf.
+func bufferedCopy(dst, src *os.File, buf []byte) (int64, error) {
+	// Hide ReadFrom and WriteTo so io.CopyBuffer uses buf.
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, buf)
+}
+
+// ctxReader is an io.Reader that fails once ctx is done.
+// If chunk is positive, it reads at most chunk bytes at a time,
+// so ctx is checked regularly when reading into a large buffer.
+type ctxReader struct {
+	ctx   context.Context
+	r     io.Reader
+	chunk int
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if r.chunk > 0 && len(p) > r.chunk {
+		p = p[:r.chunk]
+	}
+	return r.r.Read(p)
+}
+
+// ctxWriter is an io.Writer that fails once ctx is done.
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w ctxWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// disableBufPool makes getBuf allocate every buffer, for benchmarks.
+var disableBufPool = false
+
+// getBuf returns a buffer of DefaultBufferMemSize bytes for copying.
+// Return the same pointer to putBuf when done, so recycling it does
+// not allocate.
+func (f *Filer) getBuf() *[]byte {
+	size := f.DefaultBufferMemSize
+	if size <= 0 {
+		size = 1 << 16
+	}
+	if !disableBufPool {
+		if b, ok := f.bufPool.Get().(*[]byte); ok && len(*b) == size {
+			return b
+		}
+	}
+	b := make([]byte, size)
+	return &b
+}
+
+// putBuf recycles a buffer from getBuf.
+func (f *Filer) putBuf(b *[]byte) {
+	if !disableBufPool {
+		f.bufPool.Put(b)
+	}
+}
+
+// ErrFileStillOpen is returned by Filer.Remove for a file the Filer
+// has open.
+var ErrFileStillOpen = errors.New("iox: file is still open")
+
+// Remove removes the named file, as os.Remove, unless the Filer has
+// it open, in which case it returns ErrFileStillOpen.
+//
+// Open files are matched by path, after cleaning and making absolute.
+// Another path to the same file, such as a hard link, is not detected.
+func (f *Filer) Remove(name string) error {
+	if f.jail != "" {
+		var err error
+		if name, err = f.jailEntry("remove", name); err != nil {
+			return err
+		}
+	}
+	if f.isOpen(name) {
+		return &os.PathError{Op: "remove", Path: name, Err: ErrFileStillOpen}
+	}
+	return f.fs.Remove(name)
+}
+
+// isOpen reports whether the Filer has a file open at path name.
+func (f *Filer) isOpen(name string) bool {
+	name = absPath(name)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for file := range f.files {
+		if file.osfile != nil && absPath(file.fileName) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func absPath(name string) string {
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+	return filepath.Clean(name)
+}
+
+// Rename renames (moves) oldpath to newpath, as os.Rename.
+//
+// Renaming through the Filer keeps any state it holds by name
+// consistent. Files already open are unaffected, as with os.Rename.
+func (f *Filer) Rename(oldpath, newpath string) error {
+	if f.jail != "" {
+		var err error
+		if oldpath, err = f.jailEntry("rename", oldpath); err != nil {
+			return err
+		}
+		if newpath, err = f.jailEntry("rename", newpath); err != nil {
+			return err
+		}
+	}
+	return f.fs.Rename(oldpath, newpath)
+}
+
+// CopyFile copies the contents of src to dst, creating or truncating
+// dst with permission bits perm (before umask). It returns the number
+// of bytes copied.
+//
+// Both files are opened through the Filer, so CopyFile holds two file
+// descriptors while it runs and needs a Filer limit of at least two.
+// It waits until both slots are free before opening either.
+// On Linux the copy is done in the kernel with copy_file_range where
+// the filesystems allow it, and falls back to a buffered copy.
+func (f *Filer) CopyFile(dst, src string, perm os.FileMode) (n int64, err error) {
+	return f.copyFileContext(context.Background(), dst, src, perm, callers(f))
+}
+
+// CopyFileContext is CopyFile that gives up with ctx.Err() when ctx is
+// done, as it waits for file descriptors or between buffers of the
+// copy. If it gives up after creating dst, dst is removed.
+//
+// The copy is always done through a buffer, so CopyFileContext does
+// not use copy_file_range.
+func (f *Filer) CopyFileContext(ctx context.Context, dst, src string, perm os.FileMode) (int64, error) {
+	return f.copyFileContext(ctx, dst, src, perm, callers(f))
+}
+
+func (f *Filer) copyFileContext(ctx context.Context, dst, src string, perm os.FileMode, pc []uintptr) (n int64, err error) {
+	// Take both slots together: holding one while waiting for
+	// the other deadlocks concurrent copies.
+	res, err := f.reserve(ctx, 2, true, f.openWait())
+	if err != nil {
+		return 0, err
+	}
+	defer res.Release()
+
+	srcFile, err := f.openFile(ctx, src, os.O_RDONLY, 0, openOptions{res: res, origin: OriginOpenRead})
+	if err != nil {
+		return 0, err
+	}
+	srcFile.setCreator(pc)
+	defer srcFile.Close()
+
+	dstFile, err := f.openFile(ctx, dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm, openOptions{res: res, origin: OriginOpenGeneral})
+	if err != nil {
+		return 0, err
+	}
+	dstFile.setCreator(pc)
+	defer func() {
+		if closeErr := dstFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil && err == ctx.Err() {
+			f.fs.Remove(dstFile.Name())
+		}
+	}()
+
+	buf := f.getBuf()
+	if ctx.Done() == nil {
+		n, err = copyFile(dstFile.File, srcFile.File, *buf)
+	} else {
+		n, err = io.CopyBuffer(ctxWriter{ctx, dstFile.File}, ctxReader{ctx, srcFile.File, 0}, *buf)
+	}
+	f.putBuf(buf)
+	srcFile.touch()
+	dstFile.touch()
+	return n, err
+}
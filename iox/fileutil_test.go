@@ -0,0 +1,390 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFilerWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iox-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "file.txt")
+
+	filer := NewFiler(1)
+	err = filer.WriteFileAtomic(name, 0644, func(w io.Writer) error {
+		_, err := io.WriteString(w, "hello")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Errorf("file contents %q, want %q", b, "hello")
+	}
+
+	writeErr := errors.New("write failed")
+	err = filer.WriteFileAtomic(name, 0644, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return writeErr
+	})
+	if err != writeErr {
+		t.Errorf("WriteFileAtomic err=%v, want %v", err, writeErr)
+	}
+	if b, _ := ioutil.ReadFile(name); string(b) != "hello" {
+		t.Errorf("failed write changed contents to %q", b)
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		for _, fi := range infos {
+			t.Errorf("stray file: %s", fi.Name())
+		}
+	}
+	if open := filer.Stats().Open; open != 0 {
+		t.Errorf("Open=%d, want 0", open)
+	}
+}
+
+func TestFilerReadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iox-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "file.txt")
+	if err := ioutil.WriteFile(name, []byte("hello, world"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	filer := NewFiler(1)
+	for _, max := range []int64{0, 12, 100} {
+		b, err := filer.ReadFile(name, max)
+		if err != nil {
+			t.Errorf("ReadFile(%d): %v", max, err)
+		} else if string(b) != "hello, world" {
+			t.Errorf("ReadFile(%d)=%q", max, b)
+		}
+	}
+	if _, err := filer.ReadFile(name, 11); err != ErrTooLarge {
+		t.Errorf("ReadFile(11) err=%v, want ErrTooLarge", err)
+	}
+	if _, err := filer.ReadFile(filepath.Join(dir, "missing"), 0); !os.IsNotExist(err) {
+		t.Errorf("ReadFile of missing file err=%v, want os.IsNotExist", err)
+	}
+	if open := filer.Stats().Open; open != 0 {
+		t.Errorf("Open=%d, want 0", open)
+	}
+}
+
+func TestFilerCopyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iox-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	data := make([]byte, 1<<20+3)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	if err := ioutil.WriteFile(src, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	filer := NewFiler(2)
+	filer.DefaultBufferMemSize = 4096
+	dst := filepath.Join(dir, "dst")
+	testCopyFile(t, filer, dst, src, data)
+
+	if _, err := filer.CopyFile(dst, filepath.Join(dir, "missing"), 0600); !os.IsNotExist(err) {
+		t.Errorf("CopyFile(missing src) err=%v, want not exist", err)
+	}
+	if _, err := filer.CopyFile(filepath.Join(dir, "missing", "dst"), src, 0600); !os.IsNotExist(err) {
+		t.Errorf("CopyFile(missing dst dir) err=%v, want not exist", err)
+	}
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("after failed copies, Stats().Open=%d, want 0", got)
+	}
+}
+
+func TestFilerCopyFileConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := ioutil.WriteFile(src, []byte("contents"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each copy needs both slots: a copy holding one while waiting
+	// for the other would deadlock the rest. Queue all the copies
+	// while paused so they contend for the slots together.
+	filer := NewFiler(2)
+	filer.Pause()
+	const copies = 8
+	errc := make(chan error, copies)
+	for i := 0; i < copies; i++ {
+		dst := filepath.Join(dir, "dst"+strconv.Itoa(i))
+		go func() {
+			_, err := filer.CopyFile(dst, src, 0600)
+			errc <- err
+		}()
+	}
+	timeout := time.After(10 * time.Second)
+	for filer.Stats().Waiters != copies {
+		select {
+		case <-timeout:
+			t.Fatalf("Stats()=%+v, want %d waiters", filer.Stats(), copies)
+		default:
+		}
+		time.Sleep(time.Millisecond)
+	}
+	filer.Resume()
+	for i := 0; i < copies; i++ {
+		select {
+		case err := <-errc:
+			if err != nil {
+				t.Error(err)
+			}
+		case <-timeout:
+			t.Fatalf("copies deadlocked, Stats()=%+v", filer.Stats())
+		}
+	}
+	if s := filer.Stats(); s.Open != 0 || s.Waiters != 0 {
+		t.Errorf("after copies Stats()=%+v, want nothing open or waiting", s)
+	}
+}
+
+func testCopyFile(t *testing.T, filer *Filer, dst, src string, data []byte) {
+	t.Helper()
+	n, err := filer.CopyFile(dst, src, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("CopyFile n=%d, want %d", n, len(data))
+	}
+	got, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("copied contents differ")
+	}
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("after CopyFile, Stats().Open=%d, want 0", got)
+	}
+}
+
+func TestFilerRename(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iox-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filer := NewFiler(2)
+	oldpath := filepath.Join(dir, "old")
+	newpath := filepath.Join(dir, "new")
+	if err := filer.WriteFileAtomic(oldpath, 0600, func(w io.Writer) error {
+		_, err := io.WriteString(w, "contents")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := filer.Rename(oldpath, newpath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := filer.ReadFile(oldpath, 0); !os.IsNotExist(err) {
+		t.Errorf("ReadFile(old) err=%v, want not exist", err)
+	}
+	b, err := filer.ReadFile(newpath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "contents" {
+		t.Errorf("ReadFile(new)=%q, want %q", b, "contents")
+	}
+	if err := filer.Rename(oldpath, newpath); !os.IsNotExist(err) {
+		t.Errorf("Rename(missing) err=%v, want not exist", err)
+	}
+}
+
+func BenchmarkFilerCopyFile(b *testing.B) {
+	dir, err := ioutil.TempDir("", "iox-")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	if err := ioutil.WriteFile(src, make([]byte, 4096), 0600); err != nil {
+		b.Fatal(err)
+	}
+	dst := filepath.Join(dir, "dst")
+
+	for _, pool := range []bool{true, false} {
+		name := "pool"
+		if !pool {
+			name = "nopool"
+		}
+		b.Run(name, func(b *testing.B) {
+			disableBufPool = !pool
+			defer func() { disableBufPool = false }()
+
+			filer := NewFiler(2)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < 1000; j++ {
+					if _, err := filer.CopyFile(dst, src, 0600); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFilerBufPoolAllocs(t *testing.T) {
+	filer := NewFiler(1)
+	filer.putBuf(filer.getBuf())
+	allocs := testing.AllocsPerRun(100, func() {
+		filer.putBuf(filer.getBuf())
+	})
+	if allocs != 0 {
+		t.Errorf("getBuf and putBuf made %v allocations, want 0", allocs)
+	}
+}
+
+func TestFilerRemove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iox-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "f")
+	if err := ioutil.WriteFile(name, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	filer := NewFiler(1)
+	f, err := filer.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{name, filepath.Join(dir, ".", "f")} {
+		if err := filer.Remove(path); !errors.Is(err, ErrFileStillOpen) {
+			t.Errorf("Remove(%q) of open file err=%v, want ErrFileStillOpen", path, err)
+		}
+	}
+	if _, err := os.Stat(name); err != nil {
+		t.Errorf("open file was removed: %v", err)
+	}
+
+	f.Close()
+	if err := filer.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := filer.Remove(name); !os.IsNotExist(err) {
+		t.Errorf("Remove of missing file err=%v, want not exist", err)
+	}
+}
+
+// cancelAfterCtx is a context canceled by the nth call to Err.
+type cancelAfterCtx struct {
+	context.Context
+	n int32
+}
+
+func (ctx *cancelAfterCtx) Done() <-chan struct{} { return make(chan struct{}) }
+
+func (ctx *cancelAfterCtx) Err() error {
+	if atomic.AddInt32(&ctx.n, -1) < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestFilerContextHelpers(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	want := bytes.Repeat([]byte("0123456789abcdef"), 1<<14)
+	if err := ioutil.WriteFile(src, want, 0600); err != nil {
+		t.Fatal(err)
+	}
+	filer := NewFilerWithOptions(2, WithBufferMemSize(1<<12))
+
+	dst := filepath.Join(dir, "dst")
+	n, err := filer.CopyFileContext(context.Background(), dst, src, 0600)
+	if err != nil || n != int64(len(want)) {
+		t.Fatalf("CopyFileContext=%d, %v", n, err)
+	}
+	if got, err := filer.ReadFileContext(context.Background(), dst, 0); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("ReadFileContext read %d bytes, %v; want %d", len(got), err, len(want))
+	}
+
+	// Cancel partway through: 64 buffers are needed.
+	ctx := &cancelAfterCtx{Context: context.Background(), n: 10}
+	partial := filepath.Join(dir, "partial")
+	if _, err := filer.CopyFileContext(ctx, partial, src, 0600); err != context.Canceled {
+		t.Errorf("canceled CopyFileContext: %v, want context.Canceled", err)
+	}
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Errorf("canceled copy left %s: %v", partial, err)
+	}
+
+	ctx = &cancelAfterCtx{Context: context.Background(), n: 10}
+	if _, err := filer.ReadFileContext(ctx, src, 0); err != context.Canceled {
+		t.Errorf("canceled ReadFileContext: %v, want context.Canceled", err)
+	}
+
+	ctx = &cancelAfterCtx{Context: context.Background(), n: 10}
+	err = filer.WriteFileAtomicContext(ctx, filepath.Join(dir, "atomic"), 0600, func(w io.Writer) error {
+		for i := 0; i < 64; i++ {
+			if _, err := w.Write(want[:1<<12]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("canceled WriteFileAtomicContext: %v, want context.Canceled", err)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("canceled operations left files in %s: %d entries, want src and dst", dir, len(entries))
+	}
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("%d files open, want 0", got)
+	}
+}
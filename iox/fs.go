@@ -0,0 +1,97 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FS returns a file system for the tree of files rooted at root.
+//
+// Files opened through the returned fs.FS hold one of the Filer's
+// file descriptors until they are closed. The result also implements
+// fs.ReadFileFS and fs.StatFS.
+//
+// Names are slash-separated and must satisfy fs.ValidPath, so a name
+// that escapes root with ".." is rejected with fs.ErrInvalid.
+func (f *Filer) FS(root string) fs.FS {
+	return filerFS{filer: f, root: root}
+}
+
+type filerFS struct {
+	filer *Filer
+	root  string
+}
+
+func (fsys filerFS) join(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(fsys.root, filepath.FromSlash(name)), nil
+}
+
+func (fsys filerFS) Open(name string) (fs.File, error) {
+	path, err := fsys.join("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := fsys.filer.openFile(context.Background(), path, os.O_RDONLY, 0, openOptions{origin: OriginOpenRead})
+	if err != nil {
+		return nil, fsPathError("open", name, err)
+	}
+	file.setCreator(callers(fsys.filer))
+	return file, nil
+}
+
+func (fsys filerFS) ReadFile(name string) ([]byte, error) {
+	path, err := fsys.join("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := fsys.filer.ReadFile(path, 0)
+	if err != nil {
+		return nil, fsPathError("readfile", name, err)
+	}
+	return b, nil
+}
+
+func (fsys filerFS) Stat(name string) (fs.FileInfo, error) {
+	path, err := fsys.join("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	if fsys.filer.jail != "" {
+		if path, err = fsys.filer.jailPath("stat", path); err != nil {
+			return nil, fsPathError("stat", name, err)
+		}
+	}
+	fi, err := fsys.filer.fs.Stat(path)
+	if err != nil {
+		return nil, fsPathError("stat", name, err)
+	}
+	return fi, nil
+}
+
+// fsPathError reports err against the fs.FS name rather than
+// the host path, as the fs package expects.
+func fsPathError(op, name string, err error) error {
+	if pe, ok := err.(*fs.PathError); ok {
+		err = pe.Err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
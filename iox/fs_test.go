@@ -0,0 +1,87 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFilerFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iox-fs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"top.txt":     "top",
+		"a/one.txt":   "one",
+		"a/b/two.txt": "two",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filer := NewFiler(16)
+	fsys := filer.FS(dir)
+	if err := fstest.TestFS(fsys, "top.txt", "a/one.txt", "a/b/two.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := fs.ReadFile(fsys, "a/b/two.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "two" {
+		t.Errorf("ReadFile=%q, want %q", b, "two")
+	}
+
+	for _, name := range []string{"../top.txt", "a/../../x", "/etc/passwd"} {
+		if _, err := fsys.Open(name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("Open(%q) err=%v, want fs.ErrInvalid", name, err)
+		}
+	}
+	if _, err := fsys.Open("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open(missing) err=%v, want fs.ErrNotExist", err)
+	}
+
+	f1, err := fsys.Open("top.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := fsys.Open("a/one.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filer.Stats().Open; got != 2 {
+		t.Errorf("Stats().Open=%d, want 2", got)
+	}
+	f1.Close()
+	f2.Close()
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("after Close, Stats().Open=%d, want 0", got)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// fileSystem is where a Filer opens, removes, and renames files, and
+// where it finds and makes its temporary directories.
+//
+// It is the OS, except in tests, which can use an in-memory one
+// (see internal/memfs) to drive the Filer's slot accounting and
+// waiting without files on disk. Files are still *os.File, because
+// File embeds one. Operations on an open File, and helpers such as
+// Walk and File.LinkTo, use the OS directly.
+type fileSystem interface {
+	OpenFile(name string, flag int, perm os.FileMode) (*os.File, error)
+	Remove(name string) error
+	RemoveAll(name string) error
+	Rename(oldpath, newpath string) error
+	Stat(name string) (os.FileInfo, error)
+	Mkdir(name string, perm os.FileMode) error
+	MkdirAll(name string, perm os.FileMode) error
+	ReadDir(name string) ([]os.FileInfo, error)
+	Writable(dir string) error // reports an error if dir cannot be written to
+}
+
+// osOpenFile is os.OpenFile, replaced by tests.
+var osOpenFile = os.OpenFile
+
+// osFileSystem is the OS file system.
+type osFileSystem struct{}
+
+func (osFileSystem) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	return osOpenFile(name, flag, perm)
+}
+
+func (osFileSystem) Remove(name string) error                     { return os.Remove(name) }
+func (osFileSystem) RemoveAll(name string) error                  { return os.RemoveAll(name) }
+func (osFileSystem) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (osFileSystem) Stat(name string) (os.FileInfo, error)        { return os.Stat(name) }
+func (osFileSystem) Mkdir(name string, perm os.FileMode) error    { return os.Mkdir(name, perm) }
+func (osFileSystem) MkdirAll(name string, perm os.FileMode) error { return os.MkdirAll(name, perm) }
+func (osFileSystem) ReadDir(name string) ([]os.FileInfo, error)   { return ioutil.ReadDir(name) }
+func (osFileSystem) Writable(dir string) error                    { return dirWritable(dir) }
+
+// withFileSystem makes a Filer use fs for files.
+func withFileSystem(fs fileSystem) Option {
+	return func(f *Filer) { f.fs = fs }
+}
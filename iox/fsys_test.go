@@ -0,0 +1,249 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/moleculer-go/sqlite/iox/internal/memfs"
+)
+
+func TestFilerMemFSWait(t *testing.T) {
+	fs := memfs.New()
+	fs.Create("a")
+	filer := NewFilerWithOptions(2, withFileSystem(fs))
+
+	f1, err := filer.Open("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := filer.Open("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := filer.TryOpen("a"); err != ErrFilerBusy {
+		t.Fatalf("TryOpen at limit: %v, want ErrFilerBusy", err)
+	}
+
+	type result struct {
+		file *File
+		err  error
+	}
+	done := make(chan result)
+	go func() {
+		file, err := filer.OpenContext(context.Background(), "a", os.O_RDONLY, 0)
+		done <- result{file, err}
+	}()
+	for filer.Stats().Waiters == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if got := fs.Opens(); got != 2 {
+		t.Errorf("%d opens while waiting, want 2", got)
+	}
+	if err := f1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := <-done
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if got := filer.Stats(); got.Open != 2 || got.Waiters != 0 {
+		t.Errorf("after waiter opened, Stats()=%+v", got)
+	}
+
+	// A failed open releases its slot.
+	f2.Close()
+	if _, err := filer.Open("missing"); !os.IsNotExist(err) {
+		t.Errorf("Open of missing file: %v, want not exist", err)
+	}
+	if got := filer.Stats().Open; got != 1 {
+		t.Errorf("%d files open after failed open, want 1", got)
+	}
+	r.file.Close()
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("%d files open after Close, want 0", got)
+	}
+}
+
+func TestFilerMemFSOpening(t *testing.T) {
+	fs := memfs.New()
+	fs.Create("slow", "fast")
+	release := make(chan struct{})
+	fs.OpenHook = func(name string) error {
+		if name == "slow" {
+			<-release
+		}
+		return nil
+	}
+	filer := NewFilerWithOptions(1, withFileSystem(fs))
+
+	done := make(chan error)
+	go func() {
+		f, err := filer.Open("slow")
+		if err == nil {
+			err = f.Close()
+		}
+		done <- err
+	}()
+	for filer.Stats().Opening == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// The slot is held during the open.
+	if _, err := filer.TryOpen("fast"); err != ErrFilerBusy {
+		t.Errorf("TryOpen during a blocked open: %v, want ErrFilerBusy", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	fs.OpenHook = func(name string) error { return errors.New("injected") }
+	if _, err := filer.Open("fast"); err == nil {
+		t.Error("Open with failing hook succeeded")
+	}
+	if got := filer.Stats(); got.Open != 0 || got.Opening != 0 {
+		t.Errorf("after failed open, Stats()=%+v", got)
+	}
+}
+
+func TestFilerShutdownOpening(t *testing.T) {
+	fs := memfs.New()
+	fs.Create("slow", "open")
+	release := make(chan struct{})
+	fs.OpenHook = func(name string) error {
+		if name == "slow" {
+			<-release
+		}
+		return nil
+	}
+	filer := NewFilerWithOptions(2, withFileSystem(fs))
+	f1, err := filer.Open("open")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		f, err := filer.Open("slow")
+		if f != nil {
+			f.Close()
+		}
+		done <- err
+	}()
+	for filer.Stats().Opening == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	forced, err := filer.ShutdownWithReport(ctx)
+	if err != context.Canceled {
+		t.Errorf("ShutdownWithReport err=%v, want context.Canceled", err)
+	}
+	if len(forced) != 1 || forced[0] != f1.Name() {
+		t.Errorf("forced=%q, want only %q", forced, f1.Name())
+	}
+
+	// The open in progress finishes into a closed Filer.
+	close(release)
+	if err := <-done; err != ErrFilerClosed {
+		t.Errorf("open in progress at Shutdown err=%v, want ErrFilerClosed", err)
+	}
+	if got := filer.Stats(); got.Open != 0 || got.Opening != 0 {
+		t.Errorf("after Shutdown, Stats()=%+v, want nothing open", got)
+	}
+}
+
+func TestFilerMemFSTemp(t *testing.T) {
+	fs := memfs.New()
+	dir := filepath.Join(t.TempDir(), "memfs")
+	if err := fs.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	filer := NewFilerWithOptions(1, withFileSystem(fs), WithTempdir(dir))
+	filer.TempNameFunc = func(prefix, suffix string) string { return prefix + "x" + suffix }
+	fs.Create(filepath.Join(dir, "tmp-x"))
+
+	if _, err := filer.TempFile("", "tmp-", ""); err == nil {
+		t.Fatal("TempFile succeeded with every name taken")
+	}
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("%d files open after failed TempFile, want 0", got)
+	}
+
+	f, err := filer.TempFile("", "tmp2-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "tmp2-x")
+	if f.Name() != name || !fs.Exists(name) {
+		t.Errorf("temp file %s not created in memfs as %s", f.Name(), name)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Exists(name) {
+		t.Error("temp file not removed from memfs by Close")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("tempdir made on disk: %v", err)
+	}
+}
+
+func TestFilerMemFSDirs(t *testing.T) {
+	fs := memfs.New()
+	dir := filepath.Join(t.TempDir(), "memfs", "tmp")
+	filer := NewFilerWithOptions(1, withFileSystem(fs), WithTempdir(dir))
+	filer.CreateTempdir = true
+
+	tmpdir, cleanup, err := filer.TempDir("iox-memfs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := fs.Stat(tmpdir); err != nil || !fi.IsDir() {
+		t.Errorf("TempDir not made in memfs: %v", err)
+	}
+
+	name := filepath.Join(tmpdir, "f")
+	fs.Create(name + ".tmp")
+	if err := filer.Rename(name+".tmp", name); err != nil {
+		t.Fatal(err)
+	}
+	if !fs.Exists(name) || fs.Exists(name+".tmp") {
+		t.Errorf("Rename did not rename %s in memfs", name)
+	}
+
+	fs.Create(filepath.Join(dir, "stale-1"), filepath.Join(dir, "other"))
+	if n, err := filer.CleanStaleTemp("stale-", -time.Hour); n != 1 || err != nil {
+		t.Errorf("CleanStaleTemp removed %d, %v; want 1", n, err)
+	}
+	if fs.Exists(filepath.Join(dir, "stale-1")) || !fs.Exists(filepath.Join(dir, "other")) {
+		t.Error("CleanStaleTemp removed the wrong files")
+	}
+
+	if err := cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Exists(name) {
+		t.Error("TempDir cleanup left its files")
+	}
+	if _, err := os.Stat(filepath.Dir(dir)); !os.IsNotExist(err) {
+		t.Errorf("directory made on disk: %v", err)
+	}
+}
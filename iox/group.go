@@ -0,0 +1,102 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+)
+
+// A FileGroup opens files through a Filer and remembers them,
+// so they can all be closed together.
+//
+// Files in a group are ordinary Files and may be closed individually,
+// after which they leave the group.
+type FileGroup struct {
+	filer *Filer
+
+	mu    sync.Mutex
+	files map[*File]struct{}
+}
+
+// NewGroup creates an empty FileGroup for files opened from f.
+func (f *Filer) NewGroup() *FileGroup {
+	return &FileGroup{
+		filer: f,
+		files: make(map[*File]struct{}),
+	}
+}
+
+// Open is Filer.Open, adding the file to the group.
+func (g *FileGroup) Open(name string) (*File, error) {
+	file, err := g.filer.openFile(context.Background(), name, os.O_RDONLY, 0, openOptions{origin: OriginOpenRead})
+	if file != nil {
+		file.setCreator(callers(g.filer))
+		g.add(file)
+	}
+	return file, err
+}
+
+// OpenFile is Filer.OpenFile, adding the file to the group.
+func (g *FileGroup) OpenFile(name string, flag int, perm os.FileMode) (*File, error) {
+	file, err := g.filer.openFile(context.Background(), name, flag, perm, openOptions{origin: OriginOpenGeneral})
+	if file != nil {
+		file.setCreator(callers(g.filer))
+		g.add(file)
+	}
+	return file, err
+}
+
+// TempFile is Filer.TempFile, adding the file to the group.
+func (g *FileGroup) TempFile(dir, prefix, suffix string) (*File, error) {
+	file, err := g.filer.tempFile(context.Background(), dir, prefix, suffix, 0600)
+	if file != nil {
+		file.setCreator(callers(g.filer))
+		g.add(file)
+	}
+	return file, err
+}
+
+func (g *FileGroup) add(file *File) {
+	g.mu.Lock()
+	g.files[file] = struct{}{}
+	g.mu.Unlock()
+	file.OnClose(func() {
+		g.mu.Lock()
+		delete(g.files, file)
+		g.mu.Unlock()
+	})
+}
+
+// CloseAll closes the files in the group that are still open.
+// Errors from closing are joined with errors.Join.
+func (g *FileGroup) CloseAll() error {
+	g.mu.Lock()
+	files := make([]*File, 0, len(g.files))
+	for file := range g.files {
+		files = append(files, file)
+	}
+	g.mu.Unlock()
+
+	var errs []error
+	for _, file := range files {
+		if err := file.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
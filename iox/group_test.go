@@ -0,0 +1,67 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestFileGroup(t *testing.T) {
+	filer := NewFiler(4)
+	outside, err := filer.TempFile("", "iox-group-outside-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer outside.Close()
+
+	g := filer.NewGroup()
+	f1, err := g.TempFile("", "iox-group-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := g.Open(outside.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f3, err := g.OpenFile(outside.Name(), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f2.Close(); err != nil { // leaves the group
+		t.Fatal(err)
+	}
+
+	// Break f3 so its Close fails.
+	f3.File.Close()
+
+	err = g.CloseAll()
+	if !errors.Is(err, os.ErrClosed) {
+		t.Errorf("CloseAll err=%v, want os.ErrClosed from f3", err)
+	}
+	if got := filer.Stats().Open; got != 1 {
+		t.Errorf("after CloseAll, Stats().Open=%d, want 1", got)
+	}
+	if _, err := outside.Stat(); err != nil {
+		t.Errorf("file outside group: %v", err)
+	}
+	if _, err := os.Stat(f1.Name()); !os.IsNotExist(err) {
+		t.Errorf("group temp file not removed: %v", err)
+	}
+	if err := g.CloseAll(); err != nil {
+		t.Errorf("second CloseAll: %v", err)
+	}
+}
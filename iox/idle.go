@@ -0,0 +1,240 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// ErrFileClosedIdle is returned by I/O on a File that the Filer
+// closed because it was idle for longer than the idle timeout.
+var ErrFileClosedIdle = errors.New("iox: file closed after idle timeout")
+
+// SetIdleTimeout sets the duration after which an unused File is closed,
+// releasing its file descriptor.
+//
+// A File is used by calls to Read, Write, ReadAt, and WriteAt.
+// After an idle close, those methods return ErrFileClosedIdle.
+// Close must still be called on the File.
+// Temporary files are never closed for being idle.
+//
+// A duration of zero disables idle closing.
+func (f *Filer) SetIdleTimeout(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.idleTimeout = d
+	if d > 0 && !f.sweeping {
+		f.sweeping = true
+		go f.sweepIdle()
+	}
+}
+
+// sweepIdle periodically closes idle files until the idle timeout
+// is disabled or the Filer is shut down.
+func (f *Filer) sweepIdle() {
+	for {
+		f.mu.Lock()
+		d := f.idleTimeout
+		if d <= 0 {
+			f.sweeping = false
+			f.mu.Unlock()
+			return
+		}
+		f.mu.Unlock()
+
+		select {
+		case <-f.shuttingDown:
+			f.mu.Lock()
+			f.sweeping = false
+			f.mu.Unlock()
+			return
+		case <-time.After(d / 2):
+		}
+		f.closeIdle()
+	}
+}
+
+func (f *Filer) closeIdle() {
+	type closed struct {
+		name    string
+		creator string
+		dur     time.Duration
+	}
+	var closedFiles []closed
+
+	f.mu.Lock()
+	now := time.Now()
+	cutoff := now.Add(-f.idleTimeout).UnixNano()
+	for file := range f.files {
+		if file.isTemp || file.osfile == nil || atomic.LoadInt32(&file.locked) != 0 || atomic.LoadInt32(&file.closed) != 0 {
+			continue
+		}
+		if atomic.LoadInt64(&file.lastUse) > cutoff {
+			continue
+		}
+		if !file.useMu.TryLock() {
+			continue // in use
+		}
+		if atomic.LoadInt64(&file.lastUse) <= cutoff && len(file.mappings) == 0 && !file.SyncOnClose {
+			file.closeFD(file.osfile)
+			file.idleClosed = true
+			delete(f.files, file)
+			f.highWaterLocked()
+			f.grantLocked()
+			f.cond.Broadcast()
+			closedFiles = append(closedFiles, closed{file.fileName, file.creator(), now.Sub(file.openedAt)})
+		}
+		file.useMu.Unlock()
+	}
+	f.unlock()
+
+	for _, c := range closedFiles {
+		f.logFile(slog.LevelDebug, eventIdleClose, "iox.Filer: closed idle file", c.name, c.creator, "")
+		if f.OnClose != nil {
+			f.OnClose(c.name, c.dur)
+		}
+	}
+}
+
+func (file *fileState) touch() {
+	atomic.StoreInt64(&file.lastUse, time.Now().UnixNano())
+}
+
+// Read reads from the file, see os.File.Read.
+func (file *File) Read(b []byte) (n int, err error) {
+	file.useMu.RLock()
+	defer file.useMu.RUnlock()
+	if file.idleClosed {
+		return 0, ErrFileClosedIdle
+	}
+	file.touch()
+	n, err = file.File.Read(b)
+	atomic.AddInt64(&file.bytesRead, int64(n))
+	return n, err
+}
+
+// ReadAt reads from the file at an offset, see os.File.ReadAt.
+func (file *File) ReadAt(b []byte, off int64) (n int, err error) {
+	file.useMu.RLock()
+	defer file.useMu.RUnlock()
+	if file.idleClosed {
+		return 0, ErrFileClosedIdle
+	}
+	file.touch()
+	n, err = file.File.ReadAt(b, off)
+	atomic.AddInt64(&file.bytesRead, int64(n))
+	return n, err
+}
+
+// Write writes to the file, see os.File.Write.
+func (file *File) Write(b []byte) (n int, err error) {
+	file.useMu.RLock()
+	defer file.useMu.RUnlock()
+	if file.idleClosed {
+		return 0, ErrFileClosedIdle
+	}
+	file.touch()
+	n, err = file.File.Write(b)
+	file.invalidateStat()
+	atomic.AddInt64(&file.bytesWritten, int64(n))
+	return n, err
+}
+
+// WriteAt writes to the file at an offset, see os.File.WriteAt.
+func (file *File) WriteAt(b []byte, off int64) (n int, err error) {
+	file.useMu.RLock()
+	defer file.useMu.RUnlock()
+	if file.idleClosed {
+		return 0, ErrFileClosedIdle
+	}
+	file.touch()
+	n, err = file.File.WriteAt(b, off)
+	file.invalidateStat()
+	atomic.AddInt64(&file.bytesWritten, int64(n))
+	return n, err
+}
+
+// WriteString writes s to the file, see os.File.WriteString.
+func (file *File) WriteString(s string) (n int, err error) {
+	file.useMu.RLock()
+	defer file.useMu.RUnlock()
+	if file.idleClosed {
+		return 0, ErrFileClosedIdle
+	}
+	file.touch()
+	n, err = file.File.WriteString(s)
+	file.invalidateStat()
+	atomic.AddInt64(&file.bytesWritten, int64(n))
+	return n, err
+}
+
+// ReadFrom copies r to the file, see os.File.ReadFrom.
+func (file *File) ReadFrom(r io.Reader) (n int64, err error) {
+	file.useMu.RLock()
+	defer file.useMu.RUnlock()
+	if file.idleClosed {
+		return 0, ErrFileClosedIdle
+	}
+	file.touch()
+	n, err = file.File.ReadFrom(r)
+	file.invalidateStat()
+	atomic.AddInt64(&file.bytesWritten, n)
+	return n, err
+}
+
+// WriteTo copies the file to w, see os.File.WriteTo.
+func (file *File) WriteTo(w io.Writer) (n int64, err error) {
+	file.useMu.RLock()
+	defer file.useMu.RUnlock()
+	if file.idleClosed {
+		return 0, ErrFileClosedIdle
+	}
+	file.touch()
+	n, err = file.File.WriteTo(w)
+	atomic.AddInt64(&file.bytesRead, n)
+	return n, err
+}
+
+// Counters reports the number of bytes read from and written to
+// the file through the File's methods.
+func (file *File) Counters() (read, written int64) {
+	return atomic.LoadInt64(&file.bytesRead), atomic.LoadInt64(&file.bytesWritten)
+}
+
+// Truncate changes the size of the file, see os.File.Truncate.
+// If the Filer has a MaxFileSize, a larger size is rejected
+// with ErrFileTooLarge.
+func (file *File) Truncate(size int64) error {
+	file.useMu.RLock()
+	defer file.useMu.RUnlock()
+	if file.idleClosed {
+		return ErrFileClosedIdle
+	}
+	if atomic.LoadInt32(&file.closed) != 0 {
+		return &os.PathError{Op: "truncate", Path: file.Name(), Err: os.ErrClosed}
+	}
+	if max := file.filer.MaxFileSize; max > 0 && size > max {
+		return ErrFileTooLarge
+	}
+	file.touch()
+	defer file.invalidateStat()
+	return file.File.Truncate(size)
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilerIdleTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iox-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "idle")
+	if err := ioutil.WriteFile(name, []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	filer := NewFiler(3)
+	filer.SetIdleTimeout(50 * time.Millisecond)
+	defer filer.SetIdleTimeout(0)
+
+	idle, err := filer.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	busy, err := filer.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	temp, err := filer.TempFile("", "testfile1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer temp.Close()
+
+	b := make([]byte, 1)
+	for i := 0; i < 20; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if _, err := busy.ReadAt(b, 0); err != nil {
+			t.Fatalf("ReadAt on busy file: %v", err)
+		}
+	}
+
+	if _, err := idle.Read(b); err != ErrFileClosedIdle {
+		t.Errorf("Read on idle file err=%v, want ErrFileClosedIdle", err)
+	}
+	if _, err := temp.Write(b); err != nil {
+		t.Errorf("temp files should not be idle closed, Write err=%v", err)
+	}
+	if open := filer.Stats().Open; open != 2 {
+		t.Errorf("Open=%d, want 2 after idle close", open)
+	}
+	if err := idle.Close(); err != nil {
+		t.Errorf("Close of idle closed file: %v", err)
+	}
+	if err := busy.Close(); err != nil {
+		t.Error(err)
+	}
+	if open := filer.Stats().Open; open != 1 {
+		t.Errorf("Open=%d, want 1", open)
+	}
+}
+
+func TestFileTruncate(t *testing.T) {
+	filer := NewFiler(1)
+	f, err := filer.TempFile("", "iox-truncate-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := f.Stat(); err != nil || fi.Size() != 1<<20 {
+		t.Fatalf("after Truncate: size=%v, err=%v", fi.Size(), err)
+	}
+
+	filer.MaxFileSize = 4096
+	if err := f.Truncate(4096); err != nil {
+		t.Errorf("Truncate to MaxFileSize: %v", err)
+	}
+	if err := f.Truncate(4097); err != ErrFileTooLarge {
+		t.Errorf("Truncate above MaxFileSize err=%v, want ErrFileTooLarge", err)
+	}
+	if fi, err := f.Stat(); err != nil || fi.Size() != 4096 {
+		t.Errorf("after rejected Truncate: size=%v, err=%v", fi.Size(), err)
+	}
+
+	f.Close()
+	if err := f.Truncate(0); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Truncate after Close err=%v, want os.ErrClosed", err)
+	}
+}
+
+func TestFileReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iox-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "reopen")
+
+	filer := NewFiler(2)
+	f, err := filer.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Errorf("Reopen of open file: %v", err)
+	}
+
+	filer.SetIdleTimeout(20 * time.Millisecond)
+	for filer.Stats().Open != 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	filer.SetIdleTimeout(0)
+	b := make([]byte, 5)
+	if _, err := f.ReadAt(b, 0); err != ErrFileClosedIdle {
+		t.Fatalf("ReadAt on idle file err=%v, want ErrFileClosedIdle", err)
+	}
+
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if got := filer.Stats().Open; got != 1 {
+		t.Errorf("after Reopen, Stats().Open=%d, want 1", got)
+	}
+	if _, err := f.ReadAt(b, 0); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Errorf("after Reopen read %q, want %q (O_TRUNC not reapplied)", b, "hello")
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatalf("Reopen after Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	temp, err := filer.TempFile("", "iox-reopen-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	temp.Close()
+	if err := temp.Reopen(); err == nil {
+		t.Error("Reopen of closed temp file succeeded")
+	}
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("Stats().Open=%d, want 0", got)
+	}
+	if err := (&File{}).Reopen(); err != os.ErrInvalid {
+		t.Errorf("Reopen of unopened File err=%v, want os.ErrInvalid", err)
+	}
+}
+
+func TestFileCounters(t *testing.T) {
+	filer := NewFiler(1)
+	f, err := filer.TempFile("", "iox-counters-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var _ interface {
+		io.ReadWriteSeeker
+		io.ReaderAt
+		io.WriterAt
+		io.ReaderFrom
+		io.WriterTo
+		io.StringWriter
+		io.Closer
+	} = f
+
+	f.Write([]byte("hello"))
+	f.WriteAt([]byte("world"), 5) // does not move the offset
+	io.WriteString(f, "!!")
+	io.Copy(f, strings.NewReader("abc"))
+	if r, w := f.Counters(); r != 0 || w != 15 {
+		t.Errorf("after writes Counters()=%d, %d, want 0, 15", r, w)
+	}
+
+	b := make([]byte, 4)
+	f.ReadAt(b, 0)
+	f.Seek(0, io.SeekStart)
+	f.Read(b[:2])
+	io.Copy(ioutil.Discard, f) // file is 10 bytes long
+	if r, w := f.Counters(); r != 4+2+8 || w != 15 {
+		t.Errorf("after reads Counters()=%d, %d, want 14, 15", r, w)
+	}
+}
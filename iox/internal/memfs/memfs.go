@@ -0,0 +1,260 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package memfs is an in-memory file system for testing the iox
+// Filer without creating files on disk.
+//
+// Only names and modification times are kept in memory. Each open
+// file is a descriptor for os.DevNull, so reads return io.EOF and
+// writes are discarded. Directories exist only once made with Mkdir
+// or MkdirAll, but files may be created in any directory.
+package memfs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// errNotEmpty is the error of removing a directory with entries.
+// syscall.ENOTEMPTY is not defined on every platform.
+var errNotEmpty = errors.New("directory not empty")
+
+// FS is an in-memory file system. Its methods are safe to call
+// concurrently.
+type FS struct {
+	// OpenHook, if set, is called at the start of each OpenFile.
+	// If it returns an error, OpenFile fails with it. It may block,
+	// to hold an open in progress.
+	OpenHook func(name string) error
+
+	mu    sync.Mutex
+	files map[string]time.Time // modification times
+	dirs  map[string]bool
+	opens int
+}
+
+// New returns an empty FS.
+func New() *FS {
+	return &FS{
+		files: make(map[string]time.Time),
+		dirs:  make(map[string]bool),
+	}
+}
+
+// Create adds the named files to fs.
+func (fs *FS) Create(names ...string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, name := range names {
+		fs.files[name] = time.Now()
+	}
+}
+
+// Exists reports whether the named file is in fs.
+func (fs *FS) Exists(name string) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	_, ok := fs.files[name]
+	return ok
+}
+
+// Opens reports the number of successful calls to OpenFile.
+func (fs *FS) Opens() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.opens
+}
+
+// OpenFile opens the named file, as os.OpenFile.
+// The O_CREATE and O_EXCL flags are honored, perm is ignored.
+func (fs *FS) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	if fs.OpenHook != nil {
+		if err := fs.OpenHook(name); err != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	_, exists := fs.files[name]
+	switch {
+	case exists && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case !exists && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	file, err := os.OpenFile(os.DevNull, flag&(os.O_RDONLY|os.O_WRONLY|os.O_RDWR), 0)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		fs.files[name] = time.Now()
+	}
+	fs.opens++
+	return file, nil
+}
+
+// Remove removes the named file or empty directory, as os.Remove.
+func (fs *FS) Remove(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.files[name]; ok {
+		delete(fs.files, name)
+		return nil
+	}
+	if !fs.dirs[name] {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	if len(fs.readDirLocked(name)) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+	delete(fs.dirs, name)
+	return nil
+}
+
+// RemoveAll removes name and anything it contains, as os.RemoveAll.
+func (fs *FS) RemoveAll(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	prefix := name + string(filepath.Separator)
+	for file := range fs.files {
+		if file == name || strings.HasPrefix(file, prefix) {
+			delete(fs.files, file)
+		}
+	}
+	for dir := range fs.dirs {
+		if dir == name || strings.HasPrefix(dir, prefix) {
+			delete(fs.dirs, dir)
+		}
+	}
+	return nil
+}
+
+// Rename renames the file oldpath to newpath, as os.Rename.
+// Directories cannot be renamed.
+func (fs *FS) Rename(oldpath, newpath string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	mod, ok := fs.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	if fs.dirs[newpath] {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EISDIR}
+	}
+	delete(fs.files, oldpath)
+	fs.files[newpath] = mod
+	return nil
+}
+
+// Stat describes the named file or directory, as os.Stat.
+func (fs *FS) Stat(name string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fi, ok := fs.statLocked(name); ok {
+		return fi, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+// Mkdir makes the named directory, as os.Mkdir.
+// Its parent need not exist.
+func (fs *FS) Mkdir(name string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.statLocked(name); ok {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	fs.dirs[name] = true
+	return nil
+}
+
+// MkdirAll makes the named directory and its parents, as os.MkdirAll.
+func (fs *FS) MkdirAll(name string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for dir := name; ; dir = filepath.Dir(dir) {
+		if _, ok := fs.files[dir]; ok {
+			return &os.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+		}
+		fs.dirs[dir] = true
+		if parent := filepath.Dir(dir); parent == dir || parent == "." {
+			return nil
+		}
+	}
+}
+
+// Writable reports nil: an FS has no permissions.
+func (fs *FS) Writable(dir string) error { return nil }
+
+// ReadDir lists the named directory sorted by name, as ioutil.ReadDir.
+func (fs *FS) ReadDir(name string) ([]os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if !fs.dirs[name] {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return fs.readDirLocked(name), nil
+}
+
+func (fs *FS) readDirLocked(name string) []os.FileInfo {
+	var infos []os.FileInfo
+	for file, mod := range fs.files {
+		if filepath.Dir(file) == name {
+			infos = append(infos, fileInfo{name: filepath.Base(file), mod: mod})
+		}
+	}
+	for dir := range fs.dirs {
+		if dir != name && filepath.Dir(dir) == name {
+			infos = append(infos, fileInfo{name: filepath.Base(dir), dir: true})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos
+}
+
+func (fs *FS) statLocked(name string) (os.FileInfo, bool) {
+	if mod, ok := fs.files[name]; ok {
+		return fileInfo{name: filepath.Base(name), mod: mod}, true
+	}
+	if fs.dirs[name] {
+		return fileInfo{name: filepath.Base(name), dir: true}, true
+	}
+	return nil, false
+}
+
+// fileInfo is the os.FileInfo of a file or directory in an FS.
+type fileInfo struct {
+	name string
+	dir  bool
+	mod  time.Time
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return 0 }
+func (fi fileInfo) ModTime() time.Time { return fi.mod }
+func (fi fileInfo) IsDir() bool        { return fi.dir }
+func (fi fileInfo) Sys() interface{}   { return nil }
+
+func (fi fileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0700
+	}
+	return 0600
+}
@@ -17,9 +17,11 @@ package ioxtest // import "github.com/moleculer-go/sqlite/iox/ioxtest"
 import (
 	"bytes"
 	"crypto/sha1"
+	"fmt"
 	"io"
 	"math/rand"
 	"runtime/debug"
+	"sync"
 	"testing"
 )
 
@@ -37,10 +39,26 @@ import (
 //	io.ReaderAt
 //	interface{ Truncate(size int64) error }
 //
+// If Size is set and F1 implements io.Writer, Size bytes are first
+// written to F1 and F2 in chunks of up to MaxSize bytes. The data is
+// generated as it is written, so Size may be larger than memory.
+//
 // Each interface that matches is added to a pool of potential
 // operations, that are executed at random.
 // All the operations are expected to match semantically on F1 and F2.
 //
+// If F1 implements io.Writer, io.Seeker, and Truncate, a further
+// sequence of writes and truncates that shrink and grow the file
+// is checked.
+//
+// If F1 implements io.Seeker, seeks before the beginning of the file,
+// relative to the current offset and end of file, and (if F1 implements
+// io.Writer) past the end of the file followed by a write are checked.
+//
+// If Concurrent is set and F1 implements io.ReaderAt and io.WriterAt,
+// several goroutines then make interleaved ReadAt and WriteAt calls
+// on disjoint ranges of F1 and F2.
+//
 // If F1 implements io.Closer, then the object will be closed at
 // the end and the resulting error compared to F2.
 type Tester struct {
@@ -50,6 +68,8 @@ type Tester struct {
 	MaxSize    int
 	NumEvents  int
 	Invariants func()
+	Concurrent bool
+	Size       int64
 
 	off, len int64
 }
@@ -69,6 +89,10 @@ func (ft *Tester) Run() {
 		ft.NumEvents = 2048
 	}
 
+	if w, ok := ft.F1.(io.Writer); ok && ft.Size > 0 {
+		ft.fill(w, ft.F2.(io.Writer))
+	}
+
 	var tasks []func()
 	if r, ok := ft.F1.(io.Reader); ok {
 		tasks = append(tasks, func() {
@@ -114,6 +138,15 @@ func (ft *Tester) Run() {
 		}()
 	}
 
+	if t1, ok := ft.F1.(truncater); ok && !ft.T.Failed() {
+		ft.truncatePhase(t1, ft.F2.(truncater))
+	}
+	if s1, ok := ft.F1.(io.Seeker); ok && !ft.T.Failed() {
+		ft.seekPhase(s1, ft.F2.(io.Seeker))
+	}
+	if ft.Concurrent && !ft.T.Failed() {
+		ft.concurrentPhase()
+	}
 	if !ft.T.Failed() {
 		ft.finalCompare()
 	}
@@ -130,7 +163,190 @@ func (ft *Tester) Run() {
 	}
 }
 
+// seekPhase checks Seek edge cases.
+func (ft *Tester) seekPhase(s1, s2 io.Seeker) {
+	whenceName := [...]string{"io.SeekStart", "io.SeekCurrent", "io.SeekEnd"}
+	seek := func(offset int64, whence int) (n1 int64, ok bool) {
+		n1, err1 := s1.Seek(offset, whence)
+		n2, err2 := s2.Seek(offset, whence)
+		if (err1 == nil) != (err2 == nil) || (err1 == nil && n1 != n2) {
+			ft.T.Errorf("seek phase: Seek(%d, %s) n=%d, err=%v, want n=%d, err=%v", offset, whenceName[whence], n1, err1, n2, err2)
+			return n1, false
+		}
+		return n1, err1 == nil
+	}
+
+	end, ok := seek(0, io.SeekEnd)
+	if !ok {
+		return
+	}
+	ft.off = end
+	if ft.T.Failed() {
+		return
+	}
+
+	// Seeking before the beginning is an error and does not move the offset.
+	for _, test := range []struct {
+		offset int64
+		whence int
+	}{
+		{-1, io.SeekStart},
+		{-end - 1, io.SeekCurrent},
+		{-end - 1, io.SeekEnd},
+	} {
+		if _, ok := seek(test.offset, test.whence); ok {
+			ft.T.Errorf("seek phase: Seek(%d, %s) succeeded, want error", test.offset, whenceName[test.whence])
+		}
+		if off, _ := seek(0, io.SeekCurrent); off != end {
+			ft.T.Errorf("seek phase: failed Seek(%d, %s) moved offset to %d, want %d", test.offset, whenceName[test.whence], off, end)
+		}
+		if ft.T.Failed() {
+			return
+		}
+	}
+
+	// Relative seeks.
+	if end > 0 {
+		for _, test := range []struct {
+			offset int64
+			whence int
+			want   int64
+		}{
+			{end / 2, io.SeekStart, end / 2},
+			{1, io.SeekCurrent, end/2 + 1},
+			{-1, io.SeekCurrent, end / 2},
+			{-1, io.SeekEnd, end - 1},
+			{0, io.SeekEnd, end},
+		} {
+			if off, ok := seek(test.offset, test.whence); ok && off != test.want {
+				ft.T.Errorf("seek phase: Seek(%d, %s)=%d, want %d", test.offset, whenceName[test.whence], off, test.want)
+			}
+			if ft.T.Failed() {
+				return
+			}
+		}
+	}
+
+	// Seeking past the end and writing leaves a zero-filled gap.
+	w1, ok := ft.F1.(io.Writer)
+	if !ok {
+		return
+	}
+	w2 := ft.F2.(io.Writer)
+	gap := int64(ft.MaxSize/8 + 1)
+	if _, ok := seek(gap, io.SeekEnd); !ok {
+		return
+	}
+	b := []byte{'x'}
+	n1, err1 := w1.Write(b)
+	n2, err2 := w2.Write(b)
+	if n1 != n2 || err1 != nil || err2 != nil {
+		ft.T.Errorf("seek phase: Write after Seek(%d, io.SeekEnd) n=%d, err=%v, want n=%d, err=%v", gap, n1, err1, n2, err2)
+		return
+	}
+	ft.len = end + gap + 1
+	ft.off = ft.len
+	ft.compare(fmt.Sprintf("after write at %d past the end", gap))
+	if r1, ok := ft.F1.(io.ReaderAt); ok && !ft.T.Failed() {
+		zeros := make([]byte, gap)
+		n, err := r1.ReadAt(zeros, end)
+		if err != nil || n != len(zeros) {
+			ft.T.Errorf("seek phase: ReadAt of gap n=%d, err=%v", n, err)
+		} else if !bytes.Equal(zeros, make([]byte, gap)) {
+			ft.T.Errorf("seek phase: gap written past the end is not zero-filled")
+		}
+	}
+	seek(0, io.SeekEnd)
+}
+
+// concurrentPhase makes concurrent ReadAt and WriteAt calls.
+//
+// Each goroutine owns a range beyond the current end of the file,
+// so the final contents do not depend on scheduling.
+func (ft *Tester) concurrentPhase() {
+	r1, ok1 := ft.F1.(io.ReaderAt)
+	w1, ok2 := ft.F1.(io.WriterAt)
+	if !ok1 || !ok2 {
+		return
+	}
+	r2, w2 := ft.F2.(io.ReaderAt), ft.F2.(io.WriterAt)
+
+	const goroutines = 4
+	const events = 64
+	chunk := int64(ft.MaxSize/goroutines + 1)
+	base := ft.len
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		start := base + int64(g)*chunk
+		rnd := rand.New(rand.NewSource(ft.Rand.Int63()))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < events; i++ {
+				off, n := int64(0), chunk
+				if i > 0 { // first write fills the range
+					off = rnd.Int63n(chunk)
+					n = rnd.Int63n(chunk-off) + 1
+				}
+				b := make([]byte, n)
+				if i == 0 || rnd.Intn(2) == 0 {
+					rnd.Read(b)
+					n1, err1 := w1.WriteAt(b, start+off)
+					n2, err2 := w2.WriteAt(b, start+off)
+					if n1 != n2 || (err1 == nil) != (err2 == nil) {
+						ft.T.Errorf("concurrent WriteAt(b[:%d], %d) n=%d, err=%v, want n=%d, err=%v", n, start+off, n1, err1, n2, err2)
+						return
+					}
+					continue
+				}
+				b2 := make([]byte, n)
+				n1, err1 := r1.ReadAt(b, start+off)
+				n2, err2 := r2.ReadAt(b2, start+off)
+				if n1 != n2 || (err1 == nil) != (err2 == nil) {
+					ft.T.Errorf("concurrent ReadAt(b[:%d], %d) n=%d, err=%v, want n=%d, err=%v", n, start+off, n1, err1, n2, err2)
+					return
+				}
+				if !bytes.Equal(b, b2) {
+					ft.T.Errorf("concurrent ReadAt(b[:%d], %d) bytes do not match", n, start+off)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	ft.len = base + goroutines*chunk
+}
+
+// fill writes ft.Size bytes to w1 and w2 in random sized chunks.
+func (ft *Tester) fill(w1, w2 io.Writer) {
+	buf := make([]byte, ft.MaxSize)
+	for ft.len < ft.Size {
+		b := buf[:ft.Rand.Intn(len(buf))+1]
+		if rem := ft.Size - ft.len; int64(len(b)) > rem {
+			b = b[:rem]
+		}
+		ft.Rand.Read(b)
+		n1, err1 := w1.Write(b)
+		n2, err2 := w2.Write(b)
+		if n1 != n2 || err1 != nil || err2 != nil {
+			ft.T.Fatalf("fill: Write(b[:%d]) at %d n=%d, err=%v, want n=%d, err=%v", len(b), ft.len, n1, err1, n2, err2)
+		}
+		ft.len += int64(n1)
+	}
+	ft.off = ft.len
+}
+
 func (ft *Tester) finalCompare() {
+	ft.compare("final file")
+	if ft.Invariants != nil {
+		ft.Invariants()
+	}
+}
+
+// compare checks that F1 and F2 have the same contents.
+// It moves the offset of both.
+func (ft *Tester) compare(what string) {
 	if s1, ok := ft.F1.(io.Seeker); ok {
 		s2 := ft.F2.(io.Seeker)
 		if _, err := s1.Seek(0, 0); err != nil {
@@ -156,15 +372,12 @@ func (ft *Tester) finalCompare() {
 		}
 		h2 := h.Sum(nil)
 		if n1 != n2 {
-			ft.T.Fatalf("final file is %d bytes, want %d bytes", n1, n2)
+			ft.T.Fatalf("%s is %d bytes, want %d bytes", what, n1, n2)
 		}
 		if !bytes.Equal(h1, h2) {
-			ft.T.Fatalf("final file has wrong hash %x, want %x", h1, h2)
+			ft.T.Fatalf("%s has wrong hash %x, want %x", what, h1, h2)
 		}
 	}
-	if ft.Invariants != nil {
-		ft.Invariants()
-	}
 }
 
 func (ft *Tester) read(r1, r2 io.Reader) {
@@ -300,8 +513,64 @@ func (ft *Tester) truncate(s1, s2 truncater) {
 
 	err1 = s1.Truncate(size)
 	err2 := s2.Truncate(size)
+	if err1 == nil {
+		ft.len = size
+	}
 
 	if (err1 == nil && err2 != nil) || (err1 != nil && err2 == nil) {
 		ft.T.Errorf("Truncate(%d), err=%v, want err=%v", size, err1, err2)
 	}
 }
+
+// truncatePhase writes to the end of the file, then shrinks it and
+// grows it, checking the contents and offset after each step.
+func (ft *Tester) truncatePhase(t1, t2 truncater) {
+	w1, ok1 := ft.F1.(io.Writer)
+	s1, ok2 := ft.F1.(io.Seeker)
+	if !ok1 || !ok2 {
+		return
+	}
+	w2, s2 := ft.F2.(io.Writer), ft.F2.(io.Seeker)
+
+	end, err := s1.Seek(0, io.SeekEnd)
+	if err != nil {
+		ft.T.Fatal(err)
+	}
+	if _, err := s2.Seek(0, io.SeekEnd); err != nil {
+		ft.T.Fatal(err)
+	}
+	b := make([]byte, ft.MaxSize/4+1)
+	ft.Rand.Read(b)
+	if _, err := w1.Write(b); err != nil {
+		ft.T.Fatalf("truncate phase: Write: %v", err)
+	}
+	if _, err := w2.Write(b); err != nil {
+		ft.T.Fatalf("truncate phase: base Write: %v", err)
+	}
+	size := end + int64(len(b))
+
+	for _, newSize := range []int64{size / 2, size + int64(ft.MaxSize/4)} {
+		err1 := t1.Truncate(newSize)
+		err2 := t2.Truncate(newSize)
+		if err1 != nil || err2 != nil {
+			ft.T.Fatalf("truncate phase: Truncate(%d) err=%v, want err=%v", newSize, err1, err2)
+		}
+		ft.len = newSize
+
+		// Truncate does not move the offset.
+		off1, err1 := s1.Seek(0, io.SeekCurrent)
+		off2, err2 := s2.Seek(0, io.SeekCurrent)
+		if off1 != off2 || err1 != nil || err2 != nil {
+			ft.T.Fatalf("truncate phase: after Truncate(%d) offset=%d, err=%v, want offset=%d, err=%v", newSize, off1, err1, off2, err2)
+		}
+		ft.off = off1
+
+		ft.compare(fmt.Sprintf("after Truncate(%d)", newSize))
+		if _, err := s1.Seek(off1, io.SeekStart); err != nil {
+			ft.T.Fatal(err)
+		}
+		if _, err := s2.Seek(off2, io.SeekStart); err != nil {
+			ft.T.Fatal(err)
+		}
+	}
+}
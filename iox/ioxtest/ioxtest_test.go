@@ -17,6 +17,7 @@ package ioxtest
 import (
 	"bytes"
 	"io/ioutil"
+	"os"
 	"testing"
 )
 
@@ -41,3 +42,18 @@ func TestBuffer(t *testing.T) {
 	}
 	ft.Run()
 }
+
+func TestTesterConcurrent(t *testing.T) {
+	f1, err := ioutil.TempFile("", "iotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f1.Name())
+	f2, err := ioutil.TempFile("", "iotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f2.Name())
+	ft := &Tester{T: t, F1: f1, F2: f2, Concurrent: true}
+	ft.Run()
+}
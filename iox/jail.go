@@ -0,0 +1,134 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrPathEscape is returned by a Filer made with NewJailedFiler for
+// a path outside its root.
+var ErrPathEscape = errors.New("iox: path escapes Filer root")
+
+// NewJailedFiler is NewFiler for a Filer that only opens files in
+// the directory tree at root. Its tempdir is root.
+//
+// Relative names are taken relative to root. Before each open the
+// name is cleaned and its symbolic links are resolved, and if the
+// result is not inside root the open fails with an error wrapping
+// ErrPathEscape. The resolved name is opened, and is what File.Name
+// reports. Temporary file prefixes and suffixes may not contain a
+// path separator.
+//
+// The same check is made by the Filer's other methods that take
+// names, such as Remove, Rename, WriteFileAtomic, and the Stat
+// method of FS. Remove and Rename act on a symbolic link itself, so
+// only its directory must be inside root. File.OpenAt does not follow
+// symbolic links on a jailed Filer.
+//
+// The check is made before the open, so it does not protect against
+// a symbolic link changed inside root at the same time.
+func NewJailedFiler(fdLimit int, root string) *Filer {
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	return NewFilerWithOptions(fdLimit, WithTempdir(root), func(f *Filer) { f.jail = root })
+}
+
+// jailPath returns the name to open for name in the Filer's jail,
+// or an error if it is outside.
+func (f *Filer) jailPath(op, name string) (string, error) {
+	p := name
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(f.jail, p)
+	}
+	p = filepath.Clean(p)
+	if !inDir(f.jail, p) {
+		return "", &os.PathError{Op: op, Path: name, Err: ErrPathEscape}
+	}
+	resolved, err := resolveExisting(p)
+	if err != nil {
+		return "", &os.PathError{Op: op, Path: name, Err: err}
+	}
+	if !inDir(f.jail, resolved) {
+		return "", &os.PathError{Op: op, Path: name, Err: ErrPathEscape}
+	}
+	return resolved, nil
+}
+
+// jailEntry is jailPath for operations on a directory entry itself,
+// such as Remove and Rename, which do not follow a symbolic link in
+// the last element of name. Only the directory is resolved.
+func (f *Filer) jailEntry(op, name string) (string, error) {
+	p := name
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(f.jail, p)
+	}
+	p = filepath.Clean(p)
+	if p == f.jail || !inDir(f.jail, p) {
+		return "", &os.PathError{Op: op, Path: name, Err: ErrPathEscape}
+	}
+	dir, err := resolveExisting(filepath.Dir(p))
+	if err != nil {
+		return "", &os.PathError{Op: op, Path: name, Err: err}
+	}
+	if !inDir(f.jail, dir) {
+		return "", &os.PathError{Op: op, Path: name, Err: ErrPathEscape}
+	}
+	return filepath.Join(dir, filepath.Base(p)), nil
+}
+
+// jailTemp is jailPath for the directory and name parts of a
+// temporary file or directory.
+func (f *Filer) jailTemp(dir, prefix, suffix string) (string, error) {
+	if strings.ContainsAny(prefix+suffix, `/\`) {
+		return "", &os.PathError{Op: "createtemp", Path: prefix + "*" + suffix, Err: ErrPathEscape}
+	}
+	return f.jailPath("createtemp", dir)
+}
+
+// resolveExisting is filepath.EvalSymlinks for a clean absolute path
+// that may not exist yet. The longest existing prefix is resolved and
+// the rest appended.
+func resolveExisting(p string) (string, error) {
+	rest := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return filepath.Join(p, rest), nil
+		}
+		rest = filepath.Join(filepath.Base(p), rest)
+		p = parent
+	}
+}
+
+// inDir reports whether the clean absolute path p is dir or inside it.
+func inDir(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJailedFiler(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{root, filepath.Join(root, "sub"), outside} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{filepath.Join(root, "sub", "in"), filepath.Join(outside, "secret")} {
+		if err := ioutil.WriteFile(name, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filer := NewJailedFiler(4, root)
+
+	for _, name := range []string{"sub/in", "sub/../sub/in", filepath.Join(root, "sub", "in")} {
+		f, err := filer.Open(name)
+		if err != nil {
+			t.Errorf("Open(%q): %v", name, err)
+			continue
+		}
+		f.Close()
+	}
+
+	escapes := []string{
+		"../outside/secret",
+		"sub/../../outside/secret",
+		filepath.Join(outside, "secret"),
+		filepath.Join(root, "..", "outside", "secret"),
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret"), filepath.Join(root, "link")); err == nil {
+		escapes = append(escapes, "link")
+	} else {
+		t.Logf("no symlink tests: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "linkdir")); err == nil {
+		escapes = append(escapes, "linkdir/secret", "linkdir/new")
+	}
+	for _, name := range escapes {
+		if _, err := filer.OpenFile(name, os.O_RDWR|os.O_CREATE, 0600); !errors.Is(err, ErrPathEscape) {
+			t.Errorf("OpenFile(%q): %v, want ErrPathEscape", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new")); !os.IsNotExist(err) {
+		t.Errorf("file created outside root: %v", err)
+	}
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("%d files open, want 0", got)
+	}
+
+	// A symlink within root is followed.
+	if err := os.Symlink(filepath.Join(root, "sub", "in"), filepath.Join(root, "inlink")); err == nil {
+		f, err := filer.Open("inlink")
+		if err != nil {
+			t.Errorf("Open of symlink inside root: %v", err)
+		} else {
+			f.Close()
+		}
+	}
+
+	tf, err := filer.TempFile("", "iox-jail-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir := filepath.Dir(tf.Name()); dir != root {
+		t.Errorf("temp file in %s, want %s", dir, root)
+	}
+	tf.Close()
+	if _, err := filer.TempFile(outside, "iox-jail-", ""); !errors.Is(err, ErrPathEscape) {
+		t.Errorf("TempFile outside root: %v, want ErrPathEscape", err)
+	}
+	if _, err := filer.TempFile("", "../iox-jail-", ""); !errors.Is(err, ErrPathEscape) {
+		t.Errorf("TempFile with escaping prefix: %v, want ErrPathEscape", err)
+	}
+	if _, _, err := filer.TempDir("../iox-jail-"); !errors.Is(err, ErrPathEscape) {
+		t.Errorf("TempDir with escaping prefix: %v, want ErrPathEscape", err)
+	}
+}
+
+func TestJailedFilerPaths(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{root, outside} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	victim := filepath.Join(outside, "victim")
+	if err := ioutil.WriteFile(victim, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "in"), []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	filer := NewJailedFiler(4, root)
+
+	if err := filer.WriteFileAtomic(filepath.Join(outside, "x"), 0600, func(w io.Writer) error {
+		_, err := io.WriteString(w, "x")
+		return err
+	}); !errors.Is(err, ErrPathEscape) {
+		t.Errorf("WriteFileAtomic outside root: %v, want ErrPathEscape", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "x")); !os.IsNotExist(err) {
+		t.Errorf("WriteFileAtomic created a file outside root: %v", err)
+	}
+	if err := filer.Remove(victim); !errors.Is(err, ErrPathEscape) {
+		t.Errorf("Remove outside root: %v, want ErrPathEscape", err)
+	}
+	if err := filer.Rename("in", filepath.Join(outside, "in")); !errors.Is(err, ErrPathEscape) {
+		t.Errorf("Rename out of root: %v, want ErrPathEscape", err)
+	}
+	if err := filer.Rename(victim, "stolen"); !errors.Is(err, ErrPathEscape) {
+		t.Errorf("Rename into root: %v, want ErrPathEscape", err)
+	}
+	if err := filer.Rename("in", "renamed"); err != nil {
+		t.Errorf("Rename inside root: %v", err)
+	}
+
+	if err := os.Symlink(victim, filepath.Join(root, "link")); err != nil {
+		t.Skipf("no symlink tests: %v", err)
+	}
+	if _, err := filer.FS(root).(fs.StatFS).Stat("link"); !errors.Is(err, ErrPathEscape) {
+		t.Errorf("FS Stat of link out of root: %v, want ErrPathEscape", err)
+	}
+	// Remove of a symlink removes the link, not its target.
+	if err := filer.Remove("link"); err != nil {
+		t.Errorf("Remove of link: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "link")); !os.IsNotExist(err) {
+		t.Errorf("link not removed: %v", err)
+	}
+	if _, err := os.Stat(victim); err != nil {
+		t.Errorf("link target removed: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+)
+
+// ErrCrossDevice is returned, wrapped in an *os.LinkError, by
+// File.LinkTo for a destination on another filesystem.
+var ErrCrossDevice = errors.New("iox: cannot link across filesystems")
+
+// LinkTo creates dst as a hard link to the file, as os.Link.
+//
+// The file keeps its name, so a temporary file is still removed on
+// Close while dst, which shares its contents, remains. One file can
+// be linked to several destinations. LinkTo must be called before
+// Close, which removes a temporary file.
+//
+// Hard links cannot cross filesystems; if dst is on another one,
+// LinkTo returns an error wrapping ErrCrossDevice. For a Filer made
+// with NewJailedFiler, dst must be inside its root.
+func (file *File) LinkTo(dst string) error {
+	file.useMu.RLock()
+	defer file.useMu.RUnlock()
+	name := file.Name()
+	if atomic.LoadInt32(&file.closed) != 0 {
+		return &os.LinkError{Op: "link", Old: name, New: dst, Err: os.ErrClosed}
+	}
+	f := file.filer
+	if f.jail != "" {
+		var err error
+		if dst, err = f.jailPath("link", dst); err != nil {
+			return err
+		}
+	}
+	err := os.Link(name, dst)
+	if err == nil {
+		return nil
+	}
+	if _, statErr := os.Lstat(dst); os.IsNotExist(statErr) {
+		if same, sameErr := f.SameFilesystem(name, dst); sameErr == nil && !same {
+			return &os.LinkError{Op: "link", Old: name, New: dst, Err: ErrCrossDevice}
+		}
+	}
+	return err
+}
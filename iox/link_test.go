@@ -0,0 +1,88 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileLinkTo(t *testing.T) {
+	dir := t.TempDir()
+	filer := NewFilerWithOptions(1, WithTempdir(dir))
+	f, err := filer.TempFile("", "iox-link-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("linked data")
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	dst1, dst2 := filepath.Join(dir, "dst1"), filepath.Join(dir, "dst2")
+	for _, dst := range []string{dst1, dst2} {
+		if err := f.LinkTo(dst); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.LinkTo(dst1); !os.IsExist(err) || errors.Is(err, ErrCrossDevice) {
+		t.Errorf("LinkTo existing file: %v, want exist error", err)
+	}
+	tempName := f.Name()
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(tempName); !os.IsNotExist(err) {
+		t.Errorf("temp file not removed by Close: %v", err)
+	}
+	for _, dst := range []string{dst1, dst2} {
+		got, err := ioutil.ReadFile(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s contains %q, want %q", dst, got, data)
+		}
+	}
+	if err := f.LinkTo(filepath.Join(dir, "dst3")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("LinkTo after Close: %v, want os.ErrClosed", err)
+	}
+}
+
+func TestFileLinkToCrossDevice(t *testing.T) {
+	filer := NewFilerWithOptions(1, WithTempdir(t.TempDir()))
+	other, err := ioutil.TempDir("/dev/shm", "iox-link-")
+	if err != nil {
+		t.Skipf("no /dev/shm: %v", err)
+	}
+	defer os.RemoveAll(other)
+	if same, err := filer.SameFilesystem(filer.tempdir, other); err != nil || same {
+		t.Skipf("/dev/shm on the same filesystem as %s: %v", filer.tempdir, err)
+	}
+
+	f, err := filer.TempFile("", "iox-link-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var linkErr *os.LinkError
+	if err := f.LinkTo(filepath.Join(other, "dst")); !errors.Is(err, ErrCrossDevice) || !errors.As(err, &linkErr) {
+		t.Errorf("LinkTo another filesystem: %v, want *os.LinkError wrapping ErrCrossDevice", err)
+	}
+}
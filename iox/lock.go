@@ -0,0 +1,88 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+)
+
+// ErrLockUnsupported is returned by the File locking methods on
+// platforms without file locks.
+var ErrLockUnsupported = errors.New("iox: file locking not supported on this platform")
+
+// Lock takes a lock on the whole file, blocking until it is available.
+// If exclusive is true the lock is exclusive, otherwise it is shared
+// with other shared locks.
+//
+// On Unix locks are advisory flock(2) locks: they exclude only other
+// lockers, not readers or writers, and belong to the open file, so
+// two Files for the same path exclude each other even within one
+// process. On Windows the lock is taken with LockFileEx and is
+// mandatory: other processes cannot write (or, for an exclusive
+// lock, read) the file while it is held.
+//
+// A lock still held when the File is closed is released by Close.
+// A locked File is never closed for being idle.
+func (file *File) Lock(exclusive bool) error {
+	_, err := file.lock(exclusive, true)
+	return err
+}
+
+// TryLock is like Lock but does not block.
+// It reports whether the lock was taken.
+func (file *File) TryLock(exclusive bool) (bool, error) {
+	return file.lock(exclusive, false)
+}
+
+// Unlock releases a lock taken by Lock or TryLock.
+func (file *File) Unlock() error {
+	if err := file.usable(); err != nil {
+		return err
+	}
+	if err := unlockFile(file.File); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&file.locked, 0)
+	return nil
+}
+
+func (file *File) lock(exclusive, block bool) (bool, error) {
+	if err := file.usable(); err != nil {
+		return false, err
+	}
+	ok, err := lockFile(file.File, exclusive, block)
+	if ok {
+		atomic.StoreInt32(&file.locked, 1)
+	}
+	return ok, err
+}
+
+// usable reports an error if the file has been closed.
+func (file *File) usable() error {
+	if file == nil || file.File == nil {
+		return os.ErrInvalid
+	}
+	file.useMu.RLock()
+	defer file.useMu.RUnlock()
+	if file.idleClosed {
+		return ErrFileClosedIdle
+	}
+	if atomic.LoadInt32(&file.closed) != 0 {
+		return os.ErrClosed
+	}
+	return nil
+}
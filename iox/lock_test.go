@@ -0,0 +1,113 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows
+
+package iox
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLockHelper is run in a child process by TestFileLock.
+// It reports whether it can take an exclusive lock on IOX_LOCK_FILE.
+func TestLockHelper(t *testing.T) {
+	path := os.Getenv("IOX_LOCK_FILE")
+	if path == "" {
+		return
+	}
+	filer := NewFiler(1)
+	f, err := filer.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+	ok, err := f.TryLock(true)
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+	fmt.Println("locked:", ok)
+	f.Close()
+	os.Exit(0)
+}
+
+func childCanLock(t *testing.T, path string) bool {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockHelper$")
+	cmd.Env = append(os.Environ(), "IOX_LOCK_FILE="+path)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("helper: %v: %s", err, out)
+	}
+	switch s := strings.TrimSpace(string(out)); s {
+	case "locked: true":
+		return true
+	case "locked: false":
+		return false
+	default:
+		t.Fatalf("helper: unexpected output %q", s)
+		return false
+	}
+}
+
+func TestFileLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iox-lock-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lockfile")
+
+	filer := NewFiler(2)
+	f, err := filer.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Lock(true); err != nil {
+		t.Fatal(err)
+	}
+	if childCanLock(t, path) {
+		t.Error("child took lock held by parent")
+	}
+	if err := f.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if !childCanLock(t, path) {
+		t.Error("child could not take lock after Unlock")
+	}
+
+	if ok, err := f.TryLock(false); err != nil || !ok {
+		t.Fatalf("TryLock(shared)=%v, %v", ok, err)
+	}
+	if childCanLock(t, path) {
+		t.Error("child took exclusive lock over shared lock")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !childCanLock(t, path) {
+		t.Error("Close did not release lock")
+	}
+	if err := f.Lock(true); err != os.ErrClosed {
+		t.Errorf("Lock after Close err=%v, want os.ErrClosed", err)
+	}
+}
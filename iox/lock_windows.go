@@ -0,0 +1,88 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+
+	errorLockViolation syscall.Errno = 33
+
+	allBytes = uintptr(^uint32(0)) // low and high halves of the lock range
+)
+
+func lockFile(f *os.File, exclusive, block bool) (bool, error) {
+	var flags uintptr
+	if exclusive {
+		flags |= lockfileExclusiveLock
+	}
+	if !block {
+		flags |= lockfileFailImmediately
+	}
+	err := control(f, func(h uintptr) error {
+		var ol syscall.Overlapped
+		r, _, err := procLockFileEx.Call(h, flags, 0, allBytes, allBytes, uintptr(unsafe.Pointer(&ol)))
+		if r == 0 {
+			return err
+		}
+		return nil
+	})
+	if err == errorLockViolation {
+		return false, nil
+	}
+	if err != nil {
+		return false, &os.PathError{Op: "LockFileEx", Path: f.Name(), Err: err}
+	}
+	return true, nil
+}
+
+func unlockFile(f *os.File) error {
+	err := control(f, func(h uintptr) error {
+		var ol syscall.Overlapped
+		r, _, err := procUnlockFileEx.Call(h, 0, allBytes, allBytes, uintptr(unsafe.Pointer(&ol)))
+		if r == 0 {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return &os.PathError{Op: "UnlockFileEx", Path: f.Name(), Err: err}
+	}
+	return nil
+}
+
+func control(f *os.File, fn func(h uintptr) error) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var fnErr error
+	if err := rc.Control(func(h uintptr) { fnErr = fn(h) }); err != nil {
+		return err
+	}
+	return fnErr
+}
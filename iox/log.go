@@ -0,0 +1,101 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Events reported to Filer.Logger, as the "event" attribute.
+const (
+	eventShutdownWait  = "shutdown_wait"  // Shutdown is waiting for an open file
+	eventShutdownClose = "shutdown_close" // Shutdown closed an open file
+	eventLeak          = "leak"           // a File was garbage collected unclosed
+	eventIdleClose     = "idle_close"     // a File was closed for being idle
+	eventOnClosePanic  = "onclose_panic"  // an OnClose function panicked
+	eventHighWater     = "high_water"     // open files reached HighWaterPct
+	eventKeepTemp      = "keep_temp"      // Close kept a temp file marked by MarkKeep
+)
+
+// highWaterMargin is how many percentage points below HighWaterPct
+// usage must fall before the Filer warns again.
+const highWaterMargin = 10
+
+// A highWater is a HighWaterPct warning waiting to be logged.
+type highWater struct {
+	used, open, limit int
+}
+
+// highWaterLocked warns when open files reach f.HighWaterPct.
+// The warning is logged by unlock, once f.mu is released.
+// It must be called with f.mu held.
+func (f *Filer) highWaterLocked() {
+	pct, limit := f.HighWaterPct, f.fdlimit
+	if pct <= 0 || limit <= 0 {
+		return
+	}
+	used := len(f.files) * 100 / limit
+	if !f.warned && used >= pct {
+		f.warned = true
+		if f.Logger != nil || f.Logf != nil {
+			f.highWater = &highWater{used: used, open: len(f.files), limit: limit}
+		}
+	} else if f.warned && used < pct-highWaterMargin {
+		f.warned = false
+	}
+}
+
+// unlock releases f.mu, then logs any warning from highWaterLocked,
+// so a Logger that calls back into the Filer does not deadlock.
+// Paths that can open files must release f.mu with it.
+func (f *Filer) unlock() {
+	hw := f.highWater
+	f.highWater = nil
+	f.mu.Unlock()
+	if hw == nil {
+		return
+	}
+	if f.Logger != nil {
+		f.Logger.LogAttrs(context.Background(), slog.LevelWarn, "iox.Filer: open files above HighWaterPct",
+			slog.String("event", eventHighWater),
+			slog.Int("open", hw.open),
+			slog.Int("limit", hw.limit))
+	} else if f.Logf != nil {
+		f.Logf("iox.Filer: at %d%% of %d file descriptors", hw.used, hw.limit)
+	}
+}
+
+// logFile reports an event about the named file.
+//
+// If Logger is set the event is logged as a structured record with
+// msg. Otherwise, if Logf is set and format is not empty, format and
+// v are passed to Logf.
+func (f *Filer) logFile(level slog.Level, event, msg, name, creator string, format string, v ...interface{}) {
+	if f.Logger != nil {
+		attrs := []slog.Attr{
+			slog.String("event", event),
+			slog.String("file", name),
+		}
+		if creator != "" {
+			attrs = append(attrs, slog.String("creator", creator))
+		}
+		f.Logger.LogAttrs(context.Background(), level, msg, attrs...)
+		return
+	}
+	if f.Logf != nil && format != "" {
+		f.Logf(format, v...)
+	}
+}
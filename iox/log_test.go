@@ -0,0 +1,119 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestFilerLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	filer := NewFilerWithOptions(2, WithLogger(slog.New(slog.NewJSONHandler(buf, nil))))
+	var logfCalled bool
+	filer.Logf = func(string, ...interface{}) { logfCalled = true }
+
+	f, err := filer.TempFile("", "iox-logger-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	filer.ShutdownTimeout(0)
+
+	var found bool
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var rec map[string]interface{}
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec["event"] != eventShutdownClose {
+			continue
+		}
+		found = true
+		if rec["level"] != "WARN" {
+			t.Errorf("level=%v, want WARN", rec["level"])
+		}
+		if rec["file"] != f.Name() {
+			t.Errorf("file=%v, want %q", rec["file"], f.Name())
+		}
+		if creator, _ := rec["creator"].(string); !strings.HasPrefix(creator, "github.com/moleculer-go/sqlite/iox.TestFilerLogger ") {
+			t.Errorf("creator=%v, want TestFilerLogger first", rec["creator"])
+		}
+	}
+	if !found {
+		t.Errorf("no %s record in log:\n%s", eventShutdownClose, buf)
+	}
+	if logfCalled {
+		t.Error("Logf called with Logger set")
+	}
+}
+
+func TestFilerHighWaterPct(t *testing.T) {
+	var warnings []string
+	filer := NewFiler(10)
+	filer.HighWaterPct = 50
+	filer.Logf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+		filer.Stats() // a logger may use the Filer
+	}
+
+	var files []*File
+	open := func(n int) {
+		for len(files) < n {
+			f, err := filer.TempFile("", "iox-highwater-", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			files = append(files, f)
+		}
+	}
+	closeTo := func(n int) {
+		for len(files) > n {
+			files[len(files)-1].Close()
+			files = files[:len(files)-1]
+		}
+	}
+	defer closeTo(0)
+
+	open(4)
+	if len(warnings) != 0 {
+		t.Fatalf("warned below HighWaterPct: %q", warnings)
+	}
+	open(7)
+	if len(warnings) != 1 {
+		t.Fatalf("got %d warnings at 70%%, want 1: %q", len(warnings), warnings)
+	}
+	if want := "iox.Filer: at 50% of 10 file descriptors"; warnings[0] != want {
+		t.Errorf("warning %q, want %q", warnings[0], want)
+	}
+
+	// Dipping just below the threshold does not rearm the warning.
+	closeTo(4)
+	open(6)
+	if len(warnings) != 1 {
+		t.Errorf("got %d warnings after small dip, want 1", len(warnings))
+	}
+
+	closeTo(3)
+	open(5)
+	if len(warnings) != 2 {
+		t.Errorf("got %d warnings after falling below margin, want 2", len(warnings))
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+)
+
+// ErrMmapUnsupported is returned by File.Mmap on platforms
+// without memory mapped files.
+var ErrMmapUnsupported = errors.New("iox: mmap not supported on this platform")
+
+// A mapping is a region of a File mapped by Mmap.
+type mapping struct {
+	full []byte // as mapped, from an aligned offset
+	b    []byte // as returned by Mmap
+}
+
+// Mmap maps length bytes of the file starting at offset into memory,
+// read-only. The returned slice must not be written to.
+//
+// The offset need not be aligned to a page. The mapping holds the
+// File's descriptor slot until it is released with Munmap or the File
+// is closed, and a mapped File is never closed for being idle.
+// Close unmaps any mappings still held, after which their memory
+// must not be used.
+func (file *File) Mmap(offset, length int64) ([]byte, error) {
+	if offset < 0 || length <= 0 || int64(int(length)) != length {
+		return nil, &os.PathError{Op: "mmap", Path: file.Name(), Err: os.ErrInvalid}
+	}
+	file.useMu.RLock()
+	defer file.useMu.RUnlock()
+	if file.idleClosed {
+		return nil, ErrFileClosedIdle
+	}
+	if atomic.LoadInt32(&file.closed) != 0 {
+		return nil, os.ErrClosed
+	}
+
+	gran := int64(mmapGranularity())
+	start := offset &^ (gran - 1)
+	delta := int(offset - start)
+	full, err := mmapFile(file.File, start, delta+int(length))
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: file.Name(), Err: err}
+	}
+	m := &mapping{full: full, b: full[delta : delta+int(length)]}
+	f := file.filer
+	f.mu.Lock()
+	if atomic.LoadInt32(&file.closed) != 0 {
+		// Close ran during the mmap and did not see the mapping.
+		f.mu.Unlock()
+		munmapFile(full)
+		return nil, os.ErrClosed
+	}
+	file.mappings = append(file.mappings, m)
+	f.mu.Unlock()
+	return m.b, nil
+}
+
+// Munmap releases a mapping made by Mmap.
+// After Munmap the memory of b must not be used.
+func (file *File) Munmap(b []byte) error {
+	f := file.filer
+	f.mu.Lock()
+	for i, m := range file.mappings {
+		if len(b) == len(m.b) && len(b) > 0 && &b[0] == &m.b[0] {
+			file.mappings = append(file.mappings[:i], file.mappings[i+1:]...)
+			f.mu.Unlock()
+			if err := munmapFile(m.full); err != nil {
+				return &os.PathError{Op: "munmap", Path: file.Name(), Err: err}
+			}
+			return nil
+		}
+	}
+	f.mu.Unlock()
+	return &os.PathError{Op: "munmap", Path: file.Name(), Err: os.ErrInvalid}
+}
+
+// unmapAll releases any mappings left by the user.
+func (file *fileState) unmapAll() {
+	file.filer.mu.Lock()
+	mappings := file.mappings
+	file.mappings = nil
+	file.filer.mu.Unlock()
+	for _, m := range mappings {
+		munmapFile(m.full)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows
+
+package iox
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestFileMmap(t *testing.T) {
+	filer := NewFiler(2)
+	f, err := filer.TempFile("", "iox-mmap-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 200<<10)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	const off, n = 70001, 100 << 10
+	b, err := f.Mmap(off, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]byte, n)
+	if _, err := f.ReadAt(want, off); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, want) {
+		t.Error("mapped contents differ from ReadAt")
+	}
+	if err := f.Munmap(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Munmap(b); err == nil {
+		t.Error("second Munmap succeeded")
+	}
+
+	if _, err := f.Mmap(0, n); err != nil { // left for Close to unmap
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Mmap(0, n); err != os.ErrClosed {
+		t.Errorf("Mmap after Close err=%v, want os.ErrClosed", err)
+	}
+}
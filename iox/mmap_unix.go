@@ -0,0 +1,44 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package iox
+
+import (
+	"os"
+	"syscall"
+)
+
+func mmapGranularity() int { return os.Getpagesize() }
+
+func mmapFile(f *os.File, offset int64, length int) ([]byte, error) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	var mmapErr error
+	err = rc.Control(func(fd uintptr) {
+		b, mmapErr = syscall.Mmap(int(fd), offset, length, syscall.PROT_READ, syscall.MAP_SHARED)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, mmapErr
+}
+
+func munmapFile(b []byte) error {
+	return syscall.Munmap(b)
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+)
+
+// ErrOpenAtUnsupported is returned by File.OpenAt on platforms
+// without openat.
+var ErrOpenAtUnsupported = errors.New("iox: OpenAt not supported on this platform")
+
+// OpenAt opens name relative to the directory file, with a file
+// descriptor slot from the same Filer.
+//
+// The directory is the one file refers to, even if its path has since
+// been renamed or replaced, so a swapped directory cannot redirect
+// the open. To keep the open confined to the directory, name must be
+// a single path element: names containing a separator or equal to
+// "." or ".." are rejected. A symbolic link named name is followed,
+// except on a Filer made by NewJailedFiler, where the open fails.
+//
+// OpenAt is only supported on Linux. The returned File cannot be
+// reopened.
+func (file *File) OpenAt(name string, flag int, perm os.FileMode) (*File, error) {
+	if err := file.usable(); err != nil {
+		return nil, err
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, &os.PathError{Op: "openat", Path: name, Err: os.ErrInvalid}
+	}
+	f := file.filer
+	newFile, err := f.newFile(context.Background(), openOptions{origin: OriginOpenGeneral})
+	if err != nil {
+		return nil, err
+	}
+	if f.jail != "" {
+		flag |= oNoFollow // a link could lead out of the jail
+	}
+	newFile.setOpening(true)
+	osfile, err := openat(file.File, name, flag, perm)
+	newFile.setOpening(false)
+	if err == nil && f.InheritFDs {
+		if err = setInherit(osfile); err != nil {
+			osfile.Close()
+		}
+	}
+	if err != nil {
+		newFile.remove()
+		return nil, err
+	}
+	newFile.setCreator(callers(f))
+	if err := newFile.setOpened(osfile, osfile.Name()); err != nil {
+		osfile.Close()
+		newFile.remove()
+		return nil, err
+	}
+	return newFile, nil
+}
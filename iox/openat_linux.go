@@ -0,0 +1,49 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// oNoFollow is O_NOFOLLOW, for OpenAt on a jailed Filer.
+const oNoFollow = syscall.O_NOFOLLOW
+
+func openat(dir *os.File, name string, flag int, perm os.FileMode) (*os.File, error) {
+	rc, err := dir.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	fd := -1
+	var errno error
+	err = rc.Control(func(dirfd uintptr) {
+		for {
+			fd, errno = syscall.Openat(int(dirfd), name, flag|syscall.O_CLOEXEC, uint32(perm.Perm()))
+			if errno != syscall.EINTR {
+				break
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir.Name(), name)
+	if errno != nil {
+		return nil, &os.PathError{Op: "openat", Path: path, Err: errno}
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
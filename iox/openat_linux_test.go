@@ -0,0 +1,116 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileOpenAt(t *testing.T) {
+	root := t.TempDir()
+	dirName := filepath.Join(root, "dir")
+	if err := os.Mkdir(dirName, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	filer := NewFiler(2)
+	dir, err := filer.Open(dirName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+
+	f, err := dir.OpenAt("a", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.Name(), filepath.Join(dirName, "a"); got != want {
+		t.Errorf("Name()=%q, want %q", got, want)
+	}
+	if _, err := f.WriteString("moved"); err != nil {
+		t.Fatal(err)
+	}
+	if got := filer.Stats().Open; got != 2 {
+		t.Errorf("%d files open, want 2", got)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Swap the directory: OpenAt still opens relative to the original.
+	if err := os.Rename(dirName, filepath.Join(root, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(dirName, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dirName, "a"), []byte("swapped"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err = dir.OpenAt("a", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil || string(b) != "moved" {
+		t.Errorf("read %q, %v; want \"moved\"", b, err)
+	}
+
+	for _, name := range []string{"", ".", "..", "../a", "sub/a"} {
+		if _, err := dir.OpenAt(name, os.O_RDONLY, 0); !errors.Is(err, os.ErrInvalid) {
+			t.Errorf("OpenAt(%q): %v, want os.ErrInvalid", name, err)
+		}
+	}
+	if _, err := dir.OpenAt("missing", os.O_RDONLY, 0); !os.IsNotExist(err) {
+		t.Errorf("OpenAt(missing): %v, want not exist", err)
+	}
+	if got := filer.Stats().Open; got != 1 {
+		t.Errorf("%d files open, want 1", got)
+	}
+}
+
+func TestJailedFileOpenAtSymlink(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	if err := os.Mkdir(root, 0700); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(base, "secret")
+	if err := ioutil.WriteFile(secret, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	filer := NewJailedFiler(2, root)
+	dir, err := filer.Open(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+	if f, err := dir.OpenAt("link", os.O_RDONLY, 0); err == nil {
+		f.Close()
+		t.Error("OpenAt followed a symlink out of the jail")
+	}
+	if got := filer.Stats().Open; got != 1 {
+		t.Errorf("%d files open, want 1", got)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import "strconv"
+
+// FileOrigin records how a File was created.
+type FileOrigin int
+
+const (
+	OriginOpenRead    FileOrigin = iota // opened by Open and its variants, such as TryOpen
+	OriginOpenGeneral                   // opened by OpenFile and its variants, such as OpenContext
+	OriginTemp                          // created by TempFile and friends, including BufferFile
+	OriginAdopted                       // passed to Adopt
+
+	numOrigins = iota
+)
+
+func (o FileOrigin) String() string {
+	switch o {
+	case OriginOpenRead:
+		return "open-read"
+	case OriginOpenGeneral:
+		return "open"
+	case OriginTemp:
+		return "temp"
+	case OriginAdopted:
+		return "adopted"
+	}
+	return "FileOrigin(" + strconv.Itoa(int(o)) + ")"
+}
+
+// Origin reports how the File was created.
+func (file *File) Origin() FileOrigin {
+	return file.origin
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileOrigin(t *testing.T) {
+	filer := NewFiler(8)
+	name := filepath.Join(t.TempDir(), "file")
+
+	general, err := filer.OpenFile(name, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer general.Close()
+	// The origin is the method used, whatever the flags.
+	generalRead, err := filer.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer generalRead.Close()
+	read, err := filer.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer read.Close()
+	temp, err := filer.TempFile("", "iox-origin-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer temp.Close()
+	created, err := filer.CreateTemp("", "iox-origin-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer created.Close()
+	osf, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adopted, err := filer.Adopt(osf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer adopted.Close()
+
+	for _, test := range []struct {
+		file *File
+		want FileOrigin
+	}{
+		{general, OriginOpenGeneral},
+		{generalRead, OriginOpenGeneral},
+		{read, OriginOpenRead},
+		{temp, OriginTemp},
+		{created, OriginTemp},
+		{adopted, OriginAdopted},
+	} {
+		if got := test.file.Origin(); got != test.want {
+			t.Errorf("%s: Origin()=%v, want %v", test.file.Name(), got, test.want)
+		}
+	}
+
+	want := [numOrigins]int{OriginOpenRead: 1, OriginOpenGeneral: 2, OriginTemp: 2, OriginAdopted: 1}
+	if got := filer.Stats().ByOrigin; got != want {
+		t.Errorf("Stats().ByOrigin=%v, want %v", got, want)
+	}
+	for _, info := range filer.OpenFiles() {
+		if info.Name == adopted.Name() && info.Origin == OriginAdopted {
+			return
+		}
+	}
+	t.Errorf("OpenFiles() does not report the adopted file")
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"context"
+	"os"
+)
+
+// A ReadFile is a File opened for reading that has no write methods,
+// so writing to it is a compile-time error rather than a failed
+// system call.
+type ReadFile struct {
+	file *File
+}
+
+// OpenReader opens the named file for reading, as Open, and returns
+// it as a ReadFile.
+func (f *Filer) OpenReader(name string) (*ReadFile, error) {
+	file, err := f.openFile(context.Background(), name, os.O_RDONLY, 0, openOptions{origin: OriginOpenRead})
+	if err != nil {
+		return nil, err
+	}
+	file.setCreator(callers(f))
+	return &ReadFile{file: file}, nil
+}
+
+// Name returns the name of the file as passed to OpenReader.
+func (r *ReadFile) Name() string { return r.file.Name() }
+
+func (r *ReadFile) Read(b []byte) (int, error)                   { return r.file.Read(b) }
+func (r *ReadFile) ReadAt(b []byte, off int64) (int, error)      { return r.file.ReadAt(b, off) }
+func (r *ReadFile) Seek(offset int64, whence int) (int64, error) { return r.file.Seek(offset, whence) }
+func (r *ReadFile) Stat() (os.FileInfo, error)                   { return r.file.Stat() }
+
+// Close closes the file, releasing its file descriptor slot.
+func (r *ReadFile) Close() error { return r.file.Close() }
@@ -0,0 +1,64 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenReader(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(name, []byte("hello, world"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	filer := NewFiler(1)
+	r, err := filer.OpenReader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v interface{} = r
+	if _, ok := v.(io.ReaderAt); !ok {
+		t.Error("ReadFile is not an io.ReaderAt")
+	}
+	if _, ok := v.(io.ReadSeekCloser); !ok {
+		t.Error("ReadFile is not an io.ReadSeekCloser")
+	}
+	if _, ok := v.(io.Writer); ok {
+		t.Error("ReadFile is an io.Writer")
+	}
+
+	b := make([]byte, 5)
+	if _, err := r.ReadAt(b, 7); err != nil || string(b) != "world" {
+		t.Errorf("ReadAt=%q, %v", b, err)
+	}
+	if fi, err := r.Stat(); err != nil {
+		t.Error(err)
+	} else if fi.Size() != 12 {
+		t.Errorf("Stat size %d, want 12", fi.Size())
+	}
+	if got := filer.Stats().Open; got != 1 {
+		t.Errorf("%d files open, want 1", got)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := filer.Stats().Open; got != 0 {
+		t.Errorf("%d files open after Close, want 0", got)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrReservationUsed is returned by the open methods of a Reservation
+// once all its slots have been used or it has been released.
+var ErrReservationUsed = errors.New("iox: reservation has no slots left")
+
+// A Reservation is a set of file descriptor slots held by Reserve.
+// Only opens made through the Reservation use its slots.
+type Reservation struct {
+	f         *Filer
+	remaining int  // slots not yet used by an open, guarded by f.mu
+	released  bool // Release called, guarded by f.mu
+}
+
+// Reserve sets aside n file descriptor slots, so that a later group
+// of opens can be sure to succeed without blocking partway through.
+//
+// If block is true, Reserve waits until n slots are free, otherwise
+// it returns ErrFilerBusy. n slots are always taken together.
+//
+// The reserved slots are used by opening files with the returned
+// Reservation's Open and OpenFile methods. Other opens on the Filer
+// never use them. When a File opened through the Reservation is
+// closed its slot is returned to the Filer, not to the Reservation.
+// Release gives back the slots not used by an open. It must be
+// called, and may be called more than once.
+//
+// Reserve returns a Reservation, not a release function, because
+// a function alone cannot say which opens the slots are for: with
+// one, any open on the Filer could take a reserved slot and the
+// reservation would guarantee nothing. Release does the work the
+// release function would.
+//
+// Reserved slots count against the Filer's limit. A goroutine that
+// already has files open and blocks reserving more than the limit
+// allows it will wait for itself forever. Reserve reports an error
+// if n is larger than the limit. Reservations are never granted
+// after Shutdown.
+func (f *Filer) Reserve(n int, block bool) (*Reservation, error) {
+	return f.reserve(context.Background(), n, block, 0)
+}
+
+// reserve is Reserve, giving up when ctx is done or, if wait is
+// positive, with ErrFilerTimeout after waiting that long.
+func (f *Filer) reserve(ctx context.Context, n int, block bool, wait time.Duration) (*Reservation, error) {
+	res := &Reservation{f: f, remaining: n}
+	if n <= 0 {
+		res.remaining = 0
+		return res, nil
+	}
+
+	f.mu.Lock()
+	select {
+	case <-f.shuttingDown:
+		f.mu.Unlock()
+		return nil, ErrFilerClosed
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		f.mu.Unlock()
+		return nil, err
+	}
+	if n > f.fdlimit {
+		f.mu.Unlock()
+		return nil, fmt.Errorf("iox: cannot reserve %d file descriptors, Filer limit is %d", n, f.fdlimit)
+	}
+	if !f.paused && len(f.waitq) == 0 && f.takeLocked(n) {
+		f.reserved += n
+		f.mu.Unlock()
+		return res, nil
+	}
+	if !block {
+		f.mu.Unlock()
+		return nil, ErrFilerBusy
+	}
+	w := &waiter{
+		res:   res,
+		ready: make(chan struct{}),
+	}
+	f.enqueueLocked(w)
+	f.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		timeout = t.C
+	}
+	var err error
+	select {
+	case <-w.ready:
+		return res, nil
+	case <-ctx.Done():
+		err = ctx.Err()
+		if err == context.DeadlineExceeded {
+			err = ErrFilerTimeout
+		}
+	case <-timeout:
+		err = ErrFilerTimeout
+	case <-f.shuttingDown:
+		err = ErrFilerClosed
+	}
+
+	f.mu.Lock()
+	select {
+	case <-w.ready:
+		f.releaseLocked(res)
+	default:
+		f.dequeueLocked(w)
+		f.grantLocked() // w may have been blocking the head of the queue
+	}
+	f.unlock()
+	return nil, err
+}
+
+// Open opens the named file for reading, as Filer.Open, using one of
+// the reserved slots. If the open fails the slot is kept for another
+// open. It does not wait for a slot, even while the
+// Filer is paused. If no reserved slots are left it returns
+// ErrReservationUsed.
+func (res *Reservation) Open(name string) (*File, error) {
+	file, err := res.f.openFile(context.Background(), name, os.O_RDONLY, 0, openOptions{res: res, origin: OriginOpenRead})
+	if file != nil {
+		file.setCreator(callers(res.f))
+	}
+	return file, err
+}
+
+// OpenFile is Filer.OpenFile using one of the reserved slots, as Open.
+func (res *Reservation) OpenFile(name string, flag int, perm os.FileMode) (*File, error) {
+	file, err := res.f.openFile(context.Background(), name, flag, perm, openOptions{res: res, origin: OriginOpenGeneral})
+	if file != nil {
+		file.setCreator(callers(res.f))
+	}
+	return file, err
+}
+
+// Release gives back the reserved slots not used by an open.
+func (res *Reservation) Release() {
+	res.f.mu.Lock()
+	res.released = true
+	res.f.releaseLocked(res)
+	res.f.unlock()
+}
+
+// drawLocked gives file one of the slots of res.
+// It must be called with f.mu held.
+func (f *Filer) drawLocked(file *fileState, res *Reservation) error {
+	select {
+	case <-f.shuttingDown:
+		return ErrFilerClosed
+	default:
+	}
+	if res.remaining == 0 {
+		return ErrReservationUsed
+	}
+	res.remaining--
+	f.reserved--
+	f.addLocked(file)
+	return nil
+}
+
+// undraw gives the slot of file, which failed to open, back to res.
+func (f *Filer) undraw(file *fileState, res *Reservation) {
+	f.mu.Lock()
+	if res.released {
+		f.mu.Unlock()
+		file.remove()
+		return
+	}
+	delete(f.files, file)
+	res.remaining++
+	f.reserved++
+	f.mu.Unlock()
+}
+
+// releaseLocked gives back the unused slots of res.
+// It must be called with f.mu held.
+func (f *Filer) releaseLocked(res *Reservation) {
+	if res.remaining == 0 {
+		return
+	}
+	f.reserved -= res.remaining
+	res.remaining = 0
+	f.grantLocked()
+	f.cond.Broadcast()
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilerReserve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iox-reserve-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "f")
+	if err := ioutil.WriteFile(name, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	filer := NewFiler(3)
+	res, err := filer.Reserve(2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := filer.Reserve(2, false); err != ErrFilerBusy {
+		t.Errorf("second Reserve err=%v, want ErrFilerBusy", err)
+	}
+	if _, err := filer.Reserve(4, true); err == nil {
+		t.Error("Reserve above limit succeeded")
+	}
+
+	// Other opens cannot use the reserved slots.
+	f1, err := filer.TryOpen(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := filer.TryOpen(name); err != ErrFilerBusy {
+		t.Errorf("TryOpen with only reserved slots err=%v, want ErrFilerBusy", err)
+	}
+	if _, err := res.Open(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("reserved Open of missing file err=%v, want not exist", err)
+	}
+	f2, err := res.Open(name)
+	if err != nil {
+		t.Fatalf("open drawing on reservation: %v", err)
+	}
+	res.Release()
+	res.Release()
+	if _, err := res.Open(name); err != ErrReservationUsed {
+		t.Errorf("Open after Release err=%v, want ErrReservationUsed", err)
+	}
+	f3, err := filer.TryOpen(name)
+	if err != nil {
+		t.Fatalf("open after release: %v", err)
+	}
+	if _, err := filer.TryOpen(name); err != ErrFilerBusy {
+		t.Errorf("TryOpen over limit err=%v, want ErrFilerBusy", err)
+	}
+
+	// A blocking Reserve waits until all n slots are free.
+	type result struct {
+		res *Reservation
+		err error
+	}
+	resCh := make(chan result)
+	go func() {
+		res, err := filer.Reserve(2, true)
+		resCh <- result{res, err}
+	}()
+	for filer.Stats().Waiters == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	f1.Close()
+	select {
+	case <-resCh:
+		t.Fatal("Reserve(2) granted with one free slot")
+	case <-time.After(10 * time.Millisecond):
+	}
+	f2.Close()
+	r := <-resCh
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	f4, err := r.res.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("open drawing on granted reservation: %v", err)
+	}
+	r.res.Release()
+	f3.Close()
+	f4.Close()
+
+	// Shutdown wakes a blocked Reserve.
+	res, err = filer.Reserve(3, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		res, err := filer.Reserve(1, true)
+		resCh <- result{res, err}
+	}()
+	for filer.Stats().Waiters == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go filer.Shutdown(context.Background())
+	if r := <-resCh; r.err != ErrFilerClosed {
+		t.Errorf("Reserve during Shutdown err=%v, want ErrFilerClosed", r.err)
+	}
+	res.Release()
+}
+
+func TestFilerReserveExclusive(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "f")
+	if err := ioutil.WriteFile(name, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	filer := NewFiler(2)
+	res, err := filer.Reserve(2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Release()
+	if _, err := filer.TryOpen(name); err != ErrFilerBusy {
+		t.Errorf("unrelated TryOpen err=%v, want ErrFilerBusy", err)
+	}
+	for i := 0; i < 2; i++ {
+		f, err := res.Open(name)
+		if err != nil {
+			t.Fatalf("reserved open %d: %v", i, err)
+		}
+		defer f.Close()
+	}
+	if _, err := res.Open(name); err != ErrReservationUsed {
+		t.Errorf("third reserved open err=%v, want ErrReservationUsed", err)
+	}
+}
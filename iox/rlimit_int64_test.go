@@ -0,0 +1,30 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build freebsd || dragonfly
+
+package iox
+
+import "syscall"
+
+// setRlimitFields sets lim, whose fields are int64 on this platform.
+func setRlimitFields(lim *syscall.Rlimit, cur, max uint64) {
+	lim.Cur = int64(cur)
+	lim.Max = int64(max)
+}
+
+// rlimitCur reports the soft limit of lim.
+func rlimitCur(lim *syscall.Rlimit) uint64 {
+	return uint64(lim.Cur)
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package iox
+
+import (
+	"fmt"
+	"math"
+	"syscall"
+)
+
+// getrlimit and setrlimit are syscall.Getrlimit and syscall.Setrlimit,
+// replaced in tests.
+var (
+	getrlimit = syscall.Getrlimit
+	setrlimit = syscall.Setrlimit
+)
+
+// defaultFDLimit is 90% of the process's soft limit on open files.
+func defaultFDLimit() int {
+	var lim syscall.Rlimit
+	if err := getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return 90 // getrlimit failed, guess
+	}
+	cur := lim.Cur
+	if cur > math.MaxInt32 {
+		cur = math.MaxInt32 // RLIM_INFINITY
+	}
+	fdLimit := int(cur - (cur / 10))
+	if fdLimit < 1 {
+		fdLimit = 1
+	}
+	return fdLimit
+}
+
+// RaiseRlimit raises the process's soft limit on open files, if it is
+// too low, to what the Filer's limit needs, with the same 10% headroom
+// NewFiler leaves for files opened outside the Filer. The soft limit
+// is raised no further, and never above the hard limit. Without it, opens can fail with EMFILE while the Filer
+// believes it has slots to spare.
+//
+// RaiseRlimit is never called automatically. It reports an error if
+// the hard limit is too low, or the soft limit cannot be raised.
+// On platforms without rlimits it does nothing.
+func (f *Filer) RaiseRlimit() error {
+	f.mu.Lock()
+	n := f.fdlimit
+	f.mu.Unlock()
+	need := uint64(n) + uint64(n)/9 + 1
+
+	var lim syscall.Rlimit
+	if err := getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return fmt.Errorf("iox: RaiseRlimit: %w", err)
+	}
+	if uint64(lim.Cur) >= need {
+		return nil
+	}
+	if uint64(lim.Cur) < uint64(lim.Max) {
+		cur, want := uint64(lim.Cur), need
+		if max := uint64(lim.Max); want > max {
+			want = max
+		}
+		setRlimitCur(&lim, want)
+		if err := setrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+			return fmt.Errorf("iox: RaiseRlimit: raising open file limit from %d to %d: %w", cur, want, err)
+		}
+	}
+	if uint64(lim.Max) < need {
+		return fmt.Errorf("iox: RaiseRlimit: hard open file limit %d is below the %d needed for %d files", lim.Max, need, n)
+	}
+	return nil
+}
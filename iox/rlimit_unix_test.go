@@ -0,0 +1,119 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package iox
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+)
+
+func TestFilerDefaultFDLimit(t *testing.T) {
+	defer func(fn func(int, *syscall.Rlimit) error) { getrlimit = fn }(getrlimit)
+
+	tests := []struct {
+		cur, max uint64
+		err      error
+		want     int
+	}{
+		{cur: 1024, max: 1 << 20, want: 922},
+		{cur: 100, max: 100, want: 90},
+		{cur: 1, max: 1, want: 1},
+		{cur: 1024, max: 4096, err: syscall.EPERM, want: 90},
+	}
+	for _, test := range tests {
+		getrlimit = func(resource int, lim *syscall.Rlimit) error {
+			setRlimitFields(lim, test.cur, test.max)
+			return test.err
+		}
+		if got := NewFiler(0).Stats().Limit; got != test.want {
+			t.Errorf("rlimit cur=%d max=%d err=%v: limit=%d, want %d", test.cur, test.max, test.err, got, test.want)
+		}
+	}
+}
+
+func TestFilerRaiseRlimit(t *testing.T) {
+	defer func(fn func(int, *syscall.Rlimit) error) { getrlimit = fn }(getrlimit)
+	defer func(fn func(int, *syscall.Rlimit) error) { setrlimit = fn }(setrlimit)
+
+	tests := []struct {
+		cur, max uint64
+		setErr   error
+		limit    int
+		wantCur  uint64 // 0 if setrlimit is not called
+		wantErr  bool
+	}{
+		{cur: 1024, max: 4096, limit: 900, wantCur: 0},
+		{cur: 1024, max: 4096, limit: 1000, wantCur: 1112},
+		{cur: 1024, max: 1024, limit: 1000, wantErr: true},
+		{cur: 1024, max: 2048, limit: 2000, wantCur: 2048, wantErr: true},
+		{cur: 1024, max: 4096, limit: 2000, setErr: syscall.EPERM, wantCur: 2223, wantErr: true},
+		{cur: 1024, max: 1 << 62, limit: 9000, wantCur: 10001},
+	}
+	for _, test := range tests {
+		getrlimit = func(resource int, lim *syscall.Rlimit) error {
+			setRlimitFields(lim, test.cur, test.max)
+			return nil
+		}
+		var gotCur uint64
+		setrlimit = func(resource int, lim *syscall.Rlimit) error {
+			gotCur = rlimitCur(lim)
+			return test.setErr
+		}
+		err := NewFiler(test.limit).RaiseRlimit()
+		if gotCur != test.wantCur || (err != nil) != test.wantErr {
+			t.Errorf("rlimit cur=%d max=%d limit=%d: set cur=%d, err=%v; want cur=%d, err=%v",
+				test.cur, test.max, test.limit, gotCur, err, test.wantCur, test.wantErr)
+		}
+	}
+}
+
+func TestFilerRaiseRlimitProcess(t *testing.T) {
+	var orig syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &orig); err != nil {
+		t.Fatal(err)
+	}
+	if orig.Max > 1<<20 || orig.Max < 64 {
+		t.Skipf("hard open file limit %d", orig.Max)
+	}
+	defer syscall.Setrlimit(syscall.RLIMIT_NOFILE, &orig)
+
+	// Lowering the soft limit is always permitted.
+	lim := orig
+	lim.Cur = lim.Max / 2
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		t.Skipf("cannot lower soft open file limit: %v", err)
+	}
+
+	n := int(orig.Max) * 3 / 4
+	if err := NewFiler(n).RaiseRlimit(); err != nil {
+		if errors.Is(err, syscall.EPERM) {
+			t.Skip(err)
+		}
+		t.Fatal(err)
+	}
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		t.Fatal(err)
+	}
+	want := uint64(n) + uint64(n)/9 + 1
+	if max := uint64(orig.Max); want > max {
+		want = max
+	}
+	if uint64(lim.Cur) != want {
+		t.Errorf("soft open file limit %d after RaiseRlimit, want %d", lim.Cur, want)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ErrSameFilesystemUnsupported is returned by SameFilesystem on
+// platforms where it cannot tell filesystems apart.
+var ErrSameFilesystemUnsupported = errors.New("iox: SameFilesystem not supported on this platform")
+
+// SameFilesystem reports whether the files a and b are on the same
+// filesystem, so that one can be renamed over the other.
+// A file that does not exist yet is taken to be in its directory.
+//
+// On Unix the device numbers of the files are compared. On Windows
+// their volume names are compared, which does not detect volumes
+// mounted in a directory.
+//
+// SameFilesystem does not open the files.
+func (f *Filer) SameFilesystem(a, b string) (bool, error) {
+	var err error
+	if a, err = existingPath(a); err != nil {
+		return false, err
+	}
+	if b, err = existingPath(b); err != nil {
+		return false, err
+	}
+	return sameFilesystem(a, b)
+}
+
+// existingPath returns name if it exists, or else its directory.
+func existingPath(name string) (string, error) {
+	_, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		dir := filepath.Dir(name)
+		if _, err := os.Stat(dir); err != nil {
+			return "", err
+		}
+		return dir, nil
+	}
+	return name, err
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package iox
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestFilerSameFilesystem(t *testing.T) {
+	filer := NewFiler(1)
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a")
+	if err := ioutil.WriteFile(a, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	same, err := filer.SameFilesystem(a, filepath.Join(dir, "not-yet-created"))
+	if err != nil || !same {
+		t.Errorf("SameFilesystem in one directory=%v, %v; want true", same, err)
+	}
+	if _, err := filer.SameFilesystem(a, filepath.Join(dir, "missing", "b")); !os.IsNotExist(err) {
+		t.Errorf("SameFilesystem with missing directory: %v, want not exist", err)
+	}
+
+	// Find a directory on another filesystem.
+	var dirStat syscall.Stat_t
+	if err := syscall.Stat(dir, &dirStat); err != nil {
+		t.Fatal(err)
+	}
+	for _, other := range []string{"/dev/shm", "/dev", "/proc", "/sys"} {
+		var st syscall.Stat_t
+		if err := syscall.Stat(other, &st); err != nil || st.Dev == dirStat.Dev {
+			continue
+		}
+		same, err := filer.SameFilesystem(a, other)
+		if err != nil || same {
+			t.Errorf("SameFilesystem(%s, %s)=%v, %v; want false", a, other, same, err)
+		}
+		return
+	}
+	t.Skip("no second filesystem to compare with")
+}
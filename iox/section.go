@@ -0,0 +1,97 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrShortSection is returned by a SectionWriter for a write
+// that does not fit in its section.
+var ErrShortSection = errors.New("iox: write past end of section")
+
+// Section returns a reader for the length bytes of the file
+// starting at offset. Reads past the section report io.EOF.
+//
+// The reader uses the File's descriptor, so it holds no slot of its
+// own and must not be used after the File is closed.
+func (file *File) Section(offset, length int64) *io.SectionReader {
+	return io.NewSectionReader(file, offset, length)
+}
+
+// SectionWriter returns a writer for the length bytes of the file
+// starting at offset. Like Section, it uses the File's descriptor.
+func (file *File) SectionWriter(offset, length int64) *SectionWriter {
+	return &SectionWriter{file: file, base: offset, limit: length}
+}
+
+// A SectionWriter writes to a fixed region of a File.
+//
+// Offsets are relative to the start of the region. A write that
+// does not fit in the region writes as much as fits and returns
+// ErrShortSection.
+type SectionWriter struct {
+	file  *File
+	base  int64
+	off   int64
+	limit int64
+}
+
+// Write writes p at the current offset in the section.
+func (w *SectionWriter) Write(p []byte) (n int, err error) {
+	n, err = w.WriteAt(p, w.off)
+	w.off += int64(n)
+	return n, err
+}
+
+// WriteAt writes p at offset off in the section.
+func (w *SectionWriter) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 || off > w.limit {
+		return 0, ErrShortSection
+	}
+	short := false
+	if max := w.limit - off; int64(len(p)) > max {
+		p = p[:max]
+		short = true
+	}
+	n, err = w.file.WriteAt(p, w.base+off)
+	if err == nil && short {
+		err = ErrShortSection
+	}
+	return n, err
+}
+
+// Seek sets the offset for the next Write, see io.Seeker.
+// It is an error to seek outside the section.
+func (w *SectionWriter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += w.off
+	case io.SeekEnd:
+		offset += w.limit
+	default:
+		return 0, errors.New("iox.SectionWriter.Seek: invalid whence")
+	}
+	if offset < 0 || offset > w.limit {
+		return 0, errors.New("iox.SectionWriter.Seek: offset outside section")
+	}
+	w.off = offset
+	return offset, nil
+}
+
+// Size returns the size of the section in bytes.
+func (w *SectionWriter) Size() int64 { return w.limit }
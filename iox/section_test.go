@@ -0,0 +1,84 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestFileSection(t *testing.T) {
+	filer := NewFiler(1)
+	f, err := filer.TempFile("", "iox-section-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadAll(f.Section(3, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "3456" {
+		t.Errorf("Section(3, 4) read %q, want %q", b, "3456")
+	}
+	if _, err := f.Section(3, 4).ReadAt(make([]byte, 1), 4); err != io.EOF {
+		t.Errorf("ReadAt past section err=%v, want io.EOF", err)
+	}
+
+	w := f.SectionWriter(2, 5)
+	if n, err := w.Write([]byte("abc")); n != 3 || err != nil {
+		t.Errorf("Write in section n=%d, err=%v", n, err)
+	}
+	if n, err := w.Write([]byte("defg")); n != 2 || err != ErrShortSection {
+		t.Errorf("Write overflowing section n=%d, err=%v, want 2, ErrShortSection", n, err)
+	}
+	if n, err := w.WriteAt([]byte("x"), 5); n != 0 || err != ErrShortSection {
+		t.Errorf("WriteAt past section n=%d, err=%v, want 0, ErrShortSection", n, err)
+	}
+	if _, err := w.WriteAt([]byte("x"), -1); err != ErrShortSection {
+		t.Errorf("WriteAt before section err=%v, want ErrShortSection", err)
+	}
+	if _, err := w.Seek(6, io.SeekStart); err == nil {
+		t.Error("Seek past section succeeded")
+	}
+	if off, err := w.Seek(-1, io.SeekEnd); off != 4 || err != nil {
+		t.Errorf("Seek(-1, SeekEnd)=%d, %v, want 4", off, err)
+	}
+	if _, err := w.Write([]byte("Z")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]byte, 10)
+	if _, err := f.ReadAt(got, 0); err != nil {
+		t.Fatal(err)
+	}
+	if want := "01abcdZ789"; string(got) != want {
+		t.Errorf("file contents %q, want %q", got, want)
+	}
+
+	if got := filer.Stats().Open; got != 1 {
+		t.Errorf("sections took slots, Stats().Open=%d, want 1", got)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("x")); err == nil {
+		t.Error("Write to section after Close succeeded")
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import "os"
+
+// CachedStat is Stat, except that the result is remembered and
+// returned again until the file is written to or truncated through
+// this File, saving a system call when the size is checked often.
+//
+// Only Write, WriteAt, WriteString, ReadFrom, WriteAtv, Truncate,
+// and Reopen of this File invalidate the cache. Changes made any
+// other way, such as through another File, another process, or a
+// memory mapping, are not seen until then; use Stat for those.
+func (file *File) CachedStat() (os.FileInfo, error) {
+	file.statMu.Lock()
+	fi, gen := file.stat, file.statGen
+	file.statMu.Unlock()
+	if fi != nil {
+		return fi, nil
+	}
+
+	file.useMu.RLock()
+	defer file.useMu.RUnlock()
+	if file.idleClosed {
+		return nil, ErrFileClosedIdle
+	}
+	fi, err := file.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	file.statMu.Lock()
+	if file.statGen == gen {
+		// No write finished during the Stat, so fi is current.
+		file.stat = fi
+	}
+	file.statMu.Unlock()
+	return fi, nil
+}
+
+// invalidateStat discards the result cached by CachedStat.
+func (file *File) invalidateStat() {
+	file.statMu.Lock()
+	file.stat = nil
+	file.statGen++
+	file.statMu.Unlock()
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFileCachedStat(t *testing.T) {
+	filer := NewFiler(1)
+	f, err := filer.TempFile("", "iox-stat-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	size := func() int64 {
+		t.Helper()
+		fi, err := f.CachedStat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Size()
+	}
+	if got := size(); got != 10 {
+		t.Fatalf("CachedStat size %d, want 10", got)
+	}
+
+	// A change made outside the File is not seen.
+	other, err := os.OpenFile(f.Name(), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Write(make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	other.Close()
+	fi1, _ := f.CachedStat()
+	fi2, _ := f.CachedStat()
+	if fi1 != fi2 || fi1.Size() != 10 {
+		t.Errorf("CachedStat not stable: %v, %v", fi1.Size(), fi2.Size())
+	}
+	if fi, err := f.Stat(); err != nil || fi.Size() != 15 {
+		t.Errorf("Stat size %d, %v, want 15", fi.Size(), err)
+	}
+
+	if _, err := f.WriteAt([]byte{1}, 15); err != nil {
+		t.Fatal(err)
+	}
+	if got := size(); got != 16 {
+		t.Errorf("CachedStat size after WriteAt %d, want 16", got)
+	}
+	if err := f.Truncate(3); err != nil {
+		t.Fatal(err)
+	}
+	if got := size(); got != 3 {
+		t.Errorf("CachedStat size after Truncate %d, want 3", got)
+	}
+}
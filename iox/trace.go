@@ -0,0 +1,32 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import "context"
+
+// A Tracer starts spans for a Filer, so that opens and waits for
+// file descriptors appear in a tracing system such as OpenTelemetry.
+//
+// StartSpan starts a span called name as a child of any span in ctx,
+// and returns a context holding the new span and a function that ends
+// it, recording err if it is not nil. The end function is called
+// exactly once.
+//
+// The Filer starts spans named "iox.Filer.Open" and
+// "iox.Filer.TempFile" around opens, and "iox.Filer.Wait" for an
+// open blocked because all of the Filer's file descriptors are in use.
+type Tracer interface {
+	StartSpan(ctx context.Context, name string) (context.Context, func(err error))
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+type span struct {
+	name, parent string
+	ended        bool
+	err          error
+}
+
+type spanKey struct{}
+
+// fakeTracer records spans, with the parent of each taken from ctx.
+type fakeTracer struct {
+	mu    sync.Mutex
+	spans []*span
+}
+
+func (tr *fakeTracer) StartSpan(ctx context.Context, name string) (context.Context, func(error)) {
+	s := &span{name: name}
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.parent = parent.name
+	}
+	tr.mu.Lock()
+	tr.spans = append(tr.spans, s)
+	tr.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, s), func(err error) {
+		tr.mu.Lock()
+		s.ended, s.err = true, err
+		tr.mu.Unlock()
+	}
+}
+
+func (tr *fakeTracer) get() []span {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	var spans []span
+	for _, s := range tr.spans {
+		spans = append(spans, *s)
+	}
+	return spans
+}
+
+func TestFilerTracer(t *testing.T) {
+	tr := &fakeTracer{}
+	filer := NewFiler(1)
+	filer.Tracer = tr
+
+	f1, err := filer.TempFile("", "iox-trace-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tr.get(); len(got) != 1 || got[0] != (span{name: "iox.Filer.TempFile", ended: true}) {
+		t.Errorf("spans for an unblocked TempFile: %+v", got)
+	}
+	name := f1.Name() + "-regular"
+	defer os.Remove(name)
+
+	done := make(chan error)
+	go func() {
+		f2, err := filer.OpenFile(name, os.O_RDWR|os.O_CREATE, 0600)
+		if err == nil {
+			err = f2.Close()
+		}
+		done <- err
+	}()
+	for filer.Stats().Waiters == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	got := tr.get()
+	want := []span{
+		{name: "iox.Filer.TempFile", ended: true},
+		{name: "iox.Filer.Open"},
+		{name: "iox.Filer.Wait", parent: "iox.Filer.Open"},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("spans for a blocked Open: %+v, want %+v", got, want)
+	}
+	if err := f1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range tr.get() {
+		if !s.ended || s.err != nil {
+			t.Errorf("span %+v not ended without error", s)
+		}
+	}
+
+	if _, err := filer.Open(f1.Name()); err == nil {
+		t.Fatal("Open of closed temp file succeeded")
+	}
+	if got := tr.get(); got[len(got)-1].err == nil {
+		t.Errorf("failed Open span %+v has no error", got[len(got)-1])
+	}
+}
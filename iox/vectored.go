@@ -0,0 +1,54 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import "sync/atomic"
+
+// WriteAtv writes the contents of bufs, one after another, to the
+// file starting at offset off, as WriteAt would for their
+// concatenation.
+//
+// On Linux the buffers are written with pwritev, in one system call
+// for up to 1024 buffers. Elsewhere they are written one at a time.
+func (file *File) WriteAtv(bufs [][]byte, off int64) (n int, err error) {
+	file.useMu.RLock()
+	defer file.useMu.RUnlock()
+	if file.idleClosed {
+		return 0, ErrFileClosedIdle
+	}
+	file.touch()
+	n, err = writeAtv(file.File, bufs, off)
+	file.invalidateStat()
+	atomic.AddInt64(&file.bytesWritten, int64(n))
+	return n, err
+}
+
+// ReadAtv reads from the file starting at offset off into each of
+// bufs in turn, as ReadAt would into their concatenation. If fewer
+// bytes than fit in bufs are read, the error says why; at the end of
+// the file it is io.EOF.
+//
+// On Linux the buffers are read with preadv.
+func (file *File) ReadAtv(bufs [][]byte, off int64) (n int, err error) {
+	file.useMu.RLock()
+	defer file.useMu.RUnlock()
+	if file.idleClosed {
+		return 0, ErrFileClosedIdle
+	}
+	file.touch()
+	n, err = readAtv(file.File, bufs, off)
+	atomic.AddInt64(&file.bytesRead, int64(n))
+	return n, err
+}
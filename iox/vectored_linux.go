@@ -0,0 +1,113 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// iovMax is the most buffers passed to one preadv or pwritev, IOV_MAX.
+const iovMax = 1024
+
+// halfLong is half the width of a C long, for splitting offsets
+// into the pos_l and pos_h arguments of preadv and pwritev.
+const halfLong = 4 * unsafe.Sizeof(uintptr(0))
+
+func writeAtv(f *os.File, bufs [][]byte, off int64) (int, error) {
+	return vectored(f, syscall.SYS_PWRITEV, bufs, off)
+}
+
+func readAtv(f *os.File, bufs [][]byte, off int64) (int, error) {
+	return vectored(f, syscall.SYS_PREADV, bufs, off)
+}
+
+// vectored calls preadv or pwritev, named by trap, until every byte
+// of bufs has been transferred.
+func vectored(f *os.File, trap uintptr, bufs [][]byte, off int64) (n int, err error) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	iovs := make([]syscall.Iovec, 0, iovMax)
+	for {
+		// Drop the buffers already transferred. A partly transferred
+		// buffer is replaced in a copy, so bufs is not modified.
+		for len(bufs) > 0 && len(bufs[0]) == 0 {
+			bufs = bufs[1:]
+		}
+		if len(bufs) == 0 {
+			return n, nil
+		}
+		iovs = iovs[:0]
+		for _, b := range bufs {
+			if len(iovs) == iovMax {
+				break
+			}
+			if len(b) == 0 {
+				continue
+			}
+			iov := syscall.Iovec{Base: &b[0]}
+			iov.SetLen(len(b))
+			iovs = append(iovs, iov)
+		}
+
+		var m uintptr
+		var errno syscall.Errno
+		do := func(fd uintptr) bool {
+			for {
+				m, _, errno = syscall.Syscall6(trap, fd, uintptr(unsafe.Pointer(&iovs[0])), uintptr(len(iovs)),
+					uintptr(off), uintptr(uint64(off)>>halfLong>>halfLong), 0)
+				if errno != syscall.EINTR {
+					return true
+				}
+			}
+		}
+		if trap == syscall.SYS_PWRITEV {
+			err = rc.Write(do)
+		} else {
+			err = rc.Read(do)
+		}
+		if err != nil {
+			return n, err
+		}
+		if errno != 0 {
+			op := "preadv"
+			if trap == syscall.SYS_PWRITEV {
+				op = "pwritev"
+			}
+			return n, &os.PathError{Op: op, Path: f.Name(), Err: errno}
+		}
+		if m == 0 {
+			if trap == syscall.SYS_PWRITEV {
+				return n, io.ErrShortWrite
+			}
+			return n, io.EOF
+		}
+		n += int(m)
+		off += int64(m)
+
+		k := int(m)
+		for len(bufs) > 0 && len(bufs[0]) <= k {
+			k -= len(bufs[0])
+			bufs = bufs[1:]
+		}
+		if k > 0 {
+			bufs = append([][]byte{bufs[0][k:]}, bufs[1:]...)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestFileAtv(t *testing.T) {
+	filer := NewFiler(2)
+	vec, err := filer.TempFile("", "iox-vec-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vec.Close()
+	seq, err := filer.TempFile("", "iox-seq-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer seq.Close()
+
+	// More buffers than one pwritev takes, with some empty.
+	var bufs [][]byte
+	total := 0
+	for i := 0; i < 2500; i++ {
+		b := bytes.Repeat([]byte{byte(i)}, i%7)
+		bufs = append(bufs, b)
+		total += len(b)
+	}
+	const off = 100
+	n, err := vec.WriteAtv(bufs, off)
+	if err != nil || n != total {
+		t.Fatalf("WriteAtv=%d, %v, want %d", n, err, total)
+	}
+	o := int64(off)
+	for _, b := range bufs {
+		if _, err := seq.WriteAt(b, o); err != nil {
+			t.Fatal(err)
+		}
+		o += int64(len(b))
+	}
+
+	got, err := ioutil.ReadFile(vec.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(seq.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("WriteAtv wrote %d bytes different from WriteAt's %d", len(got), len(want))
+	}
+	if _, written := vec.Counters(); written != int64(total) {
+		t.Errorf("Counters written=%d, want %d", written, total)
+	}
+
+	rbufs := make([][]byte, len(bufs))
+	for i, b := range bufs {
+		rbufs[i] = make([]byte, len(b))
+	}
+	n, err = vec.ReadAtv(rbufs, off)
+	if err != nil || n != total {
+		t.Fatalf("ReadAtv=%d, %v, want %d", n, err, total)
+	}
+	for i := range bufs {
+		if !bytes.Equal(rbufs[i], bufs[i]) {
+			t.Fatalf("ReadAtv buffer %d=%v, want %v", i, rbufs[i], bufs[i])
+		}
+	}
+
+	// Reading past the end fills what it can.
+	a, b := make([]byte, 4), make([]byte, 4)
+	n, err = vec.ReadAtv([][]byte{a, b}, int64(off+total-6))
+	if err != io.EOF || n != 6 {
+		t.Errorf("ReadAtv at end=%d, %v, want 6, io.EOF", n, err)
+	}
+	if !bytes.Equal(a, want[off+total-6:off+total-2]) || !bytes.Equal(b[:2], want[off+total-2:]) {
+		t.Errorf("ReadAtv at end read %v %v", a, b[:2])
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Walk walks the file tree rooted at root, calling fn for each file
+// or directory in the tree, including root, in lexical order as
+// filepath.WalkDir does.
+//
+// Rather than opening files itself, fn is passed an open function
+// that opens the file for reading through the Filer, so a walk that
+// reads many files stays within the Filer's limit and only uses a
+// descriptor for the files it needs. fn must Close any File it opens.
+// Directories are read through the Filer too, one at a time, and
+// are closed before their entries are visited.
+//
+// If fn returns fs.SkipDir for a directory, Walk skips its contents,
+// and for a file, the rest of its directory. fs.SkipAll stops the walk.
+// Any other error stops the walk and is returned by Walk, as is an
+// error reading a directory.
+func (f *Filer) Walk(root string, fn func(path string, d fs.DirEntry, open func() (*File, error)) error) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		return err
+	}
+	err = f.walk(root, fs.FileInfoToDirEntry(info), fn)
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (f *Filer) walk(path string, d fs.DirEntry, fn func(path string, d fs.DirEntry, open func() (*File, error)) error) error {
+	open := func() (*File, error) {
+		file, err := f.Open(path)
+		if file != nil {
+			file.setCreator(callers(f))
+		}
+		return file, err
+	}
+	if err := fn(path, d, open); err != nil || !d.IsDir() {
+		return err
+	}
+
+	entries, err := f.readDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err := f.walk(filepath.Join(path, entry.Name()), entry, fn)
+		if err == fs.SkipDir {
+			if entry.IsDir() {
+				continue
+			}
+			return nil // skip the rest of this directory
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDir reads the entries of the named directory, sorted by name,
+// holding a slot from the Filer while the directory is open.
+func (f *Filer) readDir(name string) ([]fs.DirEntry, error) {
+	dir, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := dir.ReadDir(-1)
+	if cerr := dir.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2018 David Crawshaw <david@zentus.com>
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package iox
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFilerWalk(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a/1", "a/2", "b/c/3", "b/skip/4", "5"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filer := NewFiler(1) // the walk never needs more than one
+	var visited []string
+	contents := make(map[string]string)
+	err := filer.Walk(root, func(path string, d fs.DirEntry, open func() (*File, error)) error {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		visited = append(visited, rel)
+		if d.IsDir() && d.Name() == "skip" {
+			return fs.SkipDir
+		}
+		if d.IsDir() || rel == "a/2" {
+			return nil // directory, or contents not needed
+		}
+		f, err := open()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		b, err := ioutil.ReadAll(f)
+		contents[rel] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantVisited := []string{".", "5", "a", "a/1", "a/2", "b", "b/c", "b/c/3", "b/skip"}
+	if !reflect.DeepEqual(visited, wantVisited) {
+		t.Errorf("visited %q, want %q", visited, wantVisited)
+	}
+	wantContents := map[string]string{"5": "5", "a/1": "a/1", "b/c/3": "b/c/3"}
+	if !reflect.DeepEqual(contents, wantContents) {
+		t.Errorf("read %q, want %q", contents, wantContents)
+	}
+	if peak := filer.Stats().Peak; peak != 1 {
+		t.Errorf("peak %d files open, want 1", peak)
+	}
+
+	var n int
+	err = filer.Walk(root, func(path string, d fs.DirEntry, open func() (*File, error)) error {
+		if n++; n == 3 {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil || n != 3 {
+		t.Errorf("Walk with SkipAll visited %d, err=%v; want 3, nil", n, err)
+	}
+	if err := filer.Walk(filepath.Join(root, "missing"), nil); !os.IsNotExist(err) {
+		t.Errorf("Walk of missing root: %v, want not exist", err)
+	}
+}